@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// expand returns the files of the `-f` inputs: a directory is the .pdf files in
+// it and a glob pattern the files it matches. `batch` is set when there is more
+// than one file or when the inputs may have more than one, the results then
+// need the name of the file.
+func expand(inputs []string) (files []string, batch bool, err error) {
+	for _, in := range inputs {
+		if strings.ContainsAny(in, "*?[") {
+			matches, err := filepath.Glob(in)
+			if err != nil {
+				return nil, false, errors.New(fmt.Sprintf("invalid pattern %s: %s", in, err))
+			}
+			if len(matches) == 0 {
+				return nil, false, errors.New(fmt.Sprintf("no file matches %s", in))
+			}
+			files = append(files, matches...)
+			batch = true
+			continue
+		}
+		stat, err := os.Stat(in)
+		if err != nil || !stat.IsDir() {
+			// the error of a missing file is reported when it is opened
+			files = append(files, in)
+			continue
+		}
+		entries, err := ioutil.ReadDir(in)
+		if err != nil {
+			return nil, false, err
+		}
+		var dir []string
+		for _, e := range entries {
+			if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".pdf") {
+				dir = append(dir, filepath.Join(in, e.Name()))
+			}
+		}
+		if len(dir) == 0 {
+			return nil, false, errors.New(fmt.Sprintf("no PDF file in %s", in))
+		}
+		sort.Strings(dir)
+		files = append(files, dir...)
+		batch = true
+	}
+	return files, batch || len(files) > 1, nil
+}
+
+// run_recover is run where a panic is the error of the file, a malformed file
+// must not stop the other files of the batch.
+func run_recover(path string, opts options, out io.Writer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("ERROR: %v", r))
+		}
+	}()
+	return run(path, opts, out)
+}
+
+type batch_result struct {
+	out     bytes.Buffer
+	err     error
+	skipped bool // not run, the context was done before
+	done    chan struct{}
+}
+
+// run_batch runs the command on `files` with `workers` files at the same time.
+// The results are written to `out` in the order of `files`, every line starts
+// with the name of its file, and the summary of which files failed to `summary`.
+// No file is started once the context of `opts` is done. It returns how many
+// files failed.
+func run_batch(files []string, opts options, workers int, out, summary io.Writer) int {
+	results := make([]*batch_result, len(files))
+	for i := range results {
+		results[i] = &batch_result{done: make(chan struct{})}
+	}
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				r := results[i]
+				r.err = run_recover(files[i], opts, &r.out)
+				close(r.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		ctx := opts.context()
+		for i := range files {
+			if ctx.Err() == nil {
+				select {
+				case jobs <- i:
+					continue
+				case <-ctx.Done():
+				}
+			}
+			for _, r := range results[i:] {
+				r.skipped = true
+				close(r.done)
+			}
+			return
+		}
+	}()
+
+	failed, skipped := 0, 0
+	for i, r := range results {
+		<-r.done
+		if r.skipped {
+			skipped++
+			continue
+		}
+		scanner := bufio.NewScanner(&r.out)
+		scanner.Buffer(nil, r.out.Len()+1)
+		for scanner.Scan() {
+			fmt.Fprintf(out, "%s: %s\n", files[i], scanner.Text())
+		}
+		if r.err != nil {
+			failed++
+		}
+	}
+	for i, r := range results {
+		if r.skipped {
+			fmt.Fprintf(summary, "SKIP %s\n", files[i])
+		} else if r.err != nil {
+			// the errors of the parser end with a new line
+			fmt.Fprintf(summary, "FAIL %s: %s\n", files[i], strings.TrimSuffix(r.err.Error(), "\n"))
+		} else {
+			fmt.Fprintf(summary, "OK   %s\n", files[i])
+		}
+	}
+	if skipped > 0 {
+		fmt.Fprintf(summary, "%d files, %d ok, %d failed, %d skipped after the interrupt\n", len(files), len(files)-failed-skipped, failed, skipped)
+	} else {
+		fmt.Fprintf(summary, "%d files, %d ok, %d failed\n", len(files), len(files)-failed, failed)
+	}
+	return failed
+}
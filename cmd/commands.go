@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"pdf_to_data/lib/query"
+	"pdf_to_data/lib/template"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The exit codes of the commands.
+const (
+	exit_ok    = 0
+	exit_fail  = 1 // the document could not be read or the command failed
+	exit_usage = 2 // bad arguments
+)
+
+type flag_def struct {
+	name string // without the `-`
+	arg  string // name of the value, "" when the flag has none
+	help string
+	// check returns an error when the value is not valid, nil when anything is.
+	check func(value string) error
+}
+
+type command struct {
+	name  string
+	cmd   Cmd
+	args  string // the positional arguments, before the files
+	help  string
+	flags []flag_def
+}
+
+var file_flags = []flag_def{
+	{"f", "filepath", "Where the PDF file is, the files can also be given after the flags.\n" +
+		"More than one file, a directory (the .pdf files in it) or a glob pattern\n" +
+		"like 'statements/*.pdf' process the files in batch, the result lines\n" +
+		"start with the file. '-' reads the PDF from the standard input, the\n" +
+		"default when it is a pipe.", nil},
+	{"o", "output", "Write the result to output instead of the standard output. The file\n" +
+		"is only replaced when the command finishes.", nil},
+	{"j", "n", "Number of files processed at the same time in batch, the number of CPUs by default", check_workers},
+	{"strict", "", "Exit with an error when any file of the batch fails", nil},
+}
+
+func check_page(value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 {
+		return errors.New(fmt.Sprintf("Invalid page %s", value))
+	}
+	return nil
+}
+
+func check_workers(value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 {
+		return errors.New(fmt.Sprintf("Invalid number of workers %s", value))
+	}
+	return nil
+}
+
+var text_flags = []flag_def{
+	{"bookmark", "title", "Use only the text under the bookmark", nil},
+	{"freetext", "", "Add the text of FreeText annotations", nil},
+}
+
+var config_flag = flag_def{"config", "file", "The templates file, $PDF_TO_DATA_TEMPLATES or templates.json in the\n" +
+	"pdf_to_data user config directory by default", nil}
+
+var commands = []command{
+	{name: "list", cmd: list, help: "List the indexed text in the PDF file", flags: text_flags},
+	{name: "query", cmd: cmd_query, args: "'query'", help: `Print the text selected by the query.
+  @ set the index for the specified:
+    "text" match the text.
+    #123 match the index.
+  +1 increment the index by the specified number.
+  [2] indicate the number of elements to be printed per line.
+With -template the query, the format and the columns come from the templates file.
+EXAMPLE:
+  query '@"COMPARY"[6@#100]' myfile.pdf
+    print 6 elements per line, start at the text "COMPARY" and stop at the 100th index.
+  query -template nubank statement.pdf
+  query -explain '@"START"[3@"END"]'`, flags: append([]flag_def{
+		{"template", "name", "Use the query of the template name instead of 'query', with auto the\n" +
+			"template whose match rules fit the document best", nil},
+		config_flag,
+		{"explain", "", "Print the ops the query is compiled to instead of running it, no document\n" +
+			"is needed", nil},
+		{"step", "", "Print each op run with the index and the item after it and the rows it\n" +
+			"printed, to see why a loop never ends or stops too early", nil},
+	}, text_flags...)},
+	{name: "fields", cmd: fields, help: "List the name and value of the form fields"},
+	{name: "annots", cmd: annots, help: "List the annotations(comments, links…) of the pages"},
+	{name: "info", cmd: info, help: "Show the metadata of the document(title, producer, dates…)"},
+	{name: "outlines", cmd: outlines, help: "List the bookmarks and their pages"},
+	{name: "attachments", cmd: attach, help: "List the embedded files"},
+	{name: "inspect", cmd: inspect, help: `Show the objects of the document as the parser sees them, to find why a
+document is not read as expected. Without flags the trailer and the list of objects.`, flags: []flag_def{
+		{"trailer", "", "Show the trailer dictionary", nil},
+		{"xref", "", "Show where each object is according to the cross-reference sections", nil},
+		{"objects", "", "List the objects with their types", nil},
+		{"obj", "id", "Show the object id", check_id},
+		{"stream", "id", "Write the data of the stream of the object id, decoded by default", check_id},
+		{"raw", "", "With -stream, the data as it is in the file", nil},
+		{"decoded", "", "With -stream, the data with its /Filter applied", nil},
+	}},
+	{name: "trace", cmd: trace, help: `Show each operator of the content streams with its operands, the graphics and
+text state after it and the text it produced, one JSON object by line.`, flags: []flag_def{
+		{"page", "n", "Only the operators of the page n, from 1", check_page},
+	}},
+	{name: "match", cmd: match, help: "Show how much the document fits the match rules of each template, the best first", flags: []flag_def{
+		config_flag,
+	}},
+	{name: "suggest", cmd: suggest, help: `Write the query for the rows like an example row, show the rows it prints and
+save it as a template. The example row are its items in the output of list,
+separated by |.
+EXAMPLE:
+  suggest -row '06-1|Some Stuff|10' -start START -end END -save example myfile.pdf`, flags: append([]flag_def{
+		{"row", "items", "The items of a row of the document, separated by |", nil},
+		{"start", "text", "The text before the rows, the rows start at the example row without it", nil},
+		{"end", "text", "The text after the rows, they go until the end of the document without it", nil},
+		{"save", "name", "Save the query as the template name, asked when not given", nil},
+		config_flag,
+	}, text_flags...)},
+	{name: "repl", cmd: cmd_repl, help: `Read the documents once and run queries on them interactively, with the
+commands to page through and search their text. The lines are kept in the
+history file pdf_to_data/history of the user config directory.
+EXAMPLE:
+  repl statement.pdf other.pdf`, flags: text_flags},
+	{name: "export", cmd: attach, help: "Write the embedded files to a directory", flags: []flag_def{
+		{"dir", "dir", "Where the files are written, the current directory by default", nil},
+	}},
+}
+
+func find_command(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func (c *command) all_flags() []flag_def {
+	return append(append([]flag_def{}, c.flags...), file_flags...)
+}
+
+func (c *command) usage(w io.Writer, progname string) {
+	args := ""
+	if c.args != "" {
+		args = " " + c.args
+	}
+	fmt.Fprintf(w, "%s %s [flags]%s <filepath>...\n", progname, c.name, args)
+	fmt.Fprintf(w, "  %s\n", strings.Replace(c.help, "\n", "\n  ", -1))
+	fmt.Fprintf(w, "FLAGS:\n")
+	for _, f := range c.all_flags() {
+		name := "-" + f.name
+		if f.arg != "" {
+			name += " <" + f.arg + ">"
+		}
+		help := strings.Replace(f.help, "\n", "\n"+strings.Repeat(" ", 22), -1)
+		if len(name) > 18 {
+			fmt.Fprintf(w, "  %s\n%22s%s\n", name, "", help)
+		} else {
+			fmt.Fprintf(w, "  %-18s  %s\n", name, help)
+		}
+	}
+}
+
+// arg_error is a bad argument, `index` is its position in the arguments of the
+// command, used to point to it.
+type arg_error struct {
+	index int
+	msg   string
+}
+
+func (e *arg_error) Error() string {
+	return e.msg
+}
+
+// parse_args reads the flags of `c` in `args`, the arguments after the name of
+// the command. The values of the flags are in `flags`, "" for the ones without
+// value, and the rest of the arguments in `positional`. The files of `-f` are
+// appended to `files`. Flags and positional arguments can be mixed, `--` ends
+// the flags.
+func (c *command) parse_args(args []string) (flags map[string]string, positional []string, files []string, err error) {
+	flags = map[string]string{}
+	defs := c.all_flags()
+	only_positional := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if only_positional || a == "-" || !strings.HasPrefix(a, "-") {
+			positional = append(positional, a)
+			continue
+		}
+		if a == "--" {
+			only_positional = true
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		var def *flag_def
+		for j := range defs {
+			if defs[j].name == name {
+				def = &defs[j]
+			}
+		}
+		if def == nil {
+			return nil, nil, nil, &arg_error{i, fmt.Sprintf("Unknown flag %s for %s", a, c.name)}
+		}
+		if def.arg == "" {
+			flags[name] = ""
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, nil, nil, &arg_error{i, fmt.Sprintf("Missing <%s> after %s", def.arg, a)}
+		}
+		i++
+		if def.check != nil {
+			if err := def.check(args[i]); err != nil {
+				return nil, nil, nil, &arg_error{i, err.Error()}
+			}
+		}
+		if name == "f" {
+			files = append(files, args[i])
+			continue
+		}
+		flags[name] = args[i]
+	}
+	return flags, positional, files, nil
+}
+
+// show_arg_error prints the command line with the argument `index` in red and
+// a caret under it, then the error.
+func show_arg_error(w io.Writer, progname string, args []string, index int, err error) {
+	spaces := len(progname) + 1
+	io.WriteString(w, progname+" ")
+	for j, o := range args {
+		var err_b, err_e Cmd_colors
+		if j == index {
+			err_b = red
+			err_e = normal
+		}
+		io.WriteString(w, fmt.Sprintf("%s%s%s", err_b, o, err_e))
+		if j < len(args)-1 {
+			io.WriteString(w, " ")
+		}
+		if j < index {
+			spaces += len(o) + 1
+		}
+	}
+	io.WriteString(w, fmt.Sprintf("\n%*s%s^^^%s\n", spaces, "", red, normal))
+	io.WriteString(w, err.Error()+"\n")
+}
+
+// show_query_error prints the query `q` with where the error is in red and
+// carets under it, then the error. `prefix` and `suffix` are printed around the
+// query, like the rest of the command line.
+func show_query_error(w io.Writer, prefix, q, suffix string, err error) {
+	e, ok := err.(*query.Error)
+	if !ok || e.Start > e.End || e.End > len(q) {
+		io.WriteString(w, err.Error()+"\n")
+		return
+	}
+	io.WriteString(w, fmt.Sprintf("%s%s%s%s%s%s%s\n", prefix, q[:e.Start], red, q[e.Start:e.End], normal, q[e.End:], suffix))
+	spaces := utf8.RuneCountInString(prefix + q[:e.Start])
+	carets := utf8.RuneCountInString(q[e.Start:e.End])
+	if carets < 1 {
+		carets = 1
+	}
+	io.WriteString(w, fmt.Sprintf("%*s%s%s%s\n", spaces, "", red, strings.Repeat("^", carets), normal))
+	io.WriteString(w, e.Msg+"\n")
+}
+
+// options returns the options of the command and the file inputs of the
+// positional arguments.
+func (c *command) options(flags map[string]string, positional []string) (options, []string, error) {
+	opts := options{cmd: c.cmd, bookmark: flags["bookmark"]}
+	_, opts.freetext = flags["freetext"]
+	_, opts.explain = flags["explain"]
+	_, opts.step = flags["step"]
+	if opts.explain && opts.step {
+		return opts, nil, errors.New("-explain and -step can't be used together")
+	}
+	if c.name == "export" {
+		opts.attach_dir = "."
+		if dir, ok := flags["dir"]; ok {
+			opts.attach_dir = dir
+		}
+	}
+	if c.cmd == suggest {
+		row, ok := flags["row"]
+		if !ok {
+			return opts, nil, errors.New("Missing -row <items>")
+		}
+		opts.suggest = suggest_options{strings.Split(row, "|"), flags["start"], flags["end"], flags["save"], flags["config"]}
+		if opts.suggest.config == "" {
+			opts.suggest.config = template.DefaultPath()
+		}
+	}
+	if page, ok := flags["page"]; ok {
+		opts.page, _ = strconv.Atoi(page)
+	}
+	if c.cmd == inspect {
+		opts.inspect = inspect_options{obj: -1, stream: -1}
+		_, opts.inspect.trailer = flags["trailer"]
+		_, opts.inspect.xref = flags["xref"]
+		_, opts.inspect.objects = flags["objects"]
+		_, opts.inspect.raw = flags["raw"]
+		if id, ok := flags["obj"]; ok {
+			opts.inspect.obj, _ = strconv.Atoi(id)
+		}
+		if id, ok := flags["stream"]; ok {
+			opts.inspect.stream, _ = strconv.Atoi(id)
+		}
+		_, raw := flags["raw"]
+		_, decoded := flags["decoded"]
+		if (raw || decoded) && opts.inspect.stream < 0 {
+			return opts, nil, errors.New("-raw and -decoded need -stream <id>")
+		}
+		if raw && decoded {
+			return opts, nil, errors.New("-raw and -decoded can't be used together")
+		}
+	}
+	if _, ok := flags["template"]; c.args != "" && !ok {
+		if len(positional) == 0 {
+			return opts, nil, errors.New(fmt.Sprintf("Missing %s", c.args))
+		}
+		opts.arg = positional[0]
+		positional = positional[1:]
+	}
+	return opts, positional, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"pdf_to_data/lib/query"
+	"strings"
+)
+
+// show_steps runs the query `q` on `text` writing each op run with the index
+// and the item after it and the rows it printed.
+func show_steps(ctx context.Context, out io.Writer, q string, text []string) error {
+	ops, err := query.ParseQuery(q)
+	if err != nil {
+		return err
+	}
+	result, err := query.RunQueryStep(ctx, ops, text, func(s query.Step) {
+		item := fmt.Sprintf("[%s]", s.Item)
+		if s.EOF {
+			item = "end of the text"
+		}
+		fmt.Fprintf(out, "%5d  %4d  %-32s  %4d %s", s.N, s.Pc, s.Op, s.DataIndex, item)
+		if s.Next != 0 {
+			fmt.Fprintf(out, "  -> %d", s.Next)
+		}
+		fmt.Fprintln(out)
+		for _, row := range s.Rows {
+			fmt.Fprintf(out, "             row: %s\n", strings.Join(row, "\t"))
+		}
+	})
+	fmt.Fprintf(out, "%d rows\n", len(result))
+	return err
+}
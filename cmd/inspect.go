@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	pdf_parser "pdf_to_data/lib/pdf"
+	"strconv"
+)
+
+// inspector is what the inspect command shows of a document.
+type inspector interface {
+	Trailer() string
+	XRef() []pdf_parser.XRefEntry
+	Objects() []pdf_parser.ObjectInfo
+	Object(id int) (string, error)
+	Stream(id int, decoded bool) ([]byte, error)
+}
+
+// inspect_options are the parts of the document shown by inspect, the trailer
+// and the list of objects when nothing is selected.
+type inspect_options struct {
+	trailer bool
+	xref    bool
+	objects bool
+	obj     int // -1 when not selected
+	stream  int
+	raw     bool
+}
+
+func check_id(value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return errors.New(fmt.Sprintf("Invalid object id %s", value))
+	}
+	return nil
+}
+
+func show_inspect(out io.Writer, doc inspector, opts inspect_options) error {
+	if !opts.trailer && !opts.xref && !opts.objects && opts.obj < 0 && opts.stream < 0 {
+		opts.trailer, opts.objects = true, true
+	}
+	if opts.trailer {
+		fmt.Fprintf(out, "trailer\n%s\n", doc.Trailer())
+	}
+	if opts.xref {
+		fmt.Fprintf(out, "xref\n")
+		for _, e := range doc.XRef() {
+			switch e.Kind {
+			case "offset":
+				fmt.Fprintf(out, "%6d: offset %d\n", e.Id, e.Offset)
+			case "objstm":
+				fmt.Fprintf(out, "%6d: in object stream %d, index %d\n", e.Id, e.Stream, e.Index)
+			default:
+				fmt.Fprintf(out, "%6d: %s\n", e.Id, e.Kind)
+			}
+		}
+	}
+	if opts.objects {
+		fmt.Fprintf(out, "objects\n")
+		for _, o := range doc.Objects() {
+			if o.Stream {
+				fmt.Fprintf(out, "%6d: %s, %d bytes\n", o.Id, o.Type, o.Length)
+			} else {
+				fmt.Fprintf(out, "%6d: %s\n", o.Id, o.Type)
+			}
+		}
+	}
+	if opts.obj >= 0 {
+		s, err := doc.Object(opts.obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, s)
+	}
+	if opts.stream >= 0 {
+		data, err := doc.Stream(opts.stream, !opts.raw)
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,36 +1,84 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	pdf_parser "pdf_to_data/lib/pdf"
 	"pdf_to_data/lib/query"
+	"pdf_to_data/lib/template"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func usage(progname string) {
-	fmt.Printf(`%s usage:
-%s -f <filepath> cmd
-  -f <filepath>     Indicates where the PDF file is
-  cmd               The command you want to execute
-    -list           List the indexed text in the PDF file
-    -query 'query' The query you want to use.
-     @ set the index for the specified:
-       "text" match the text.
-       #123 match the index.
-       +1 increment the index by the specified number.
-       [2] indicate the number of elements to be printed per line.
-  EXAMPLE:
-    %s -f myfile.pdf -query '@"COMPARY"[6@#100]'
-      print 6 elements per line, start at the text "COMPARY" and stop at the 100th index.
-    `, progname, progname, progname)
+func usage(w io.Writer, progname string) {
+	fmt.Fprintf(w, `%s usage:
+%s <command> [flags] <filepath>...
+%s help <command>
+COMMANDS:
+`, progname, progname, progname)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s  %s\n", c.name, strings.SplitN(c.help, "\n", 2)[0])
+	}
+	fmt.Fprintf(w, `EXAMPLE:
+  %s list myfile.pdf
+  %s query '@"COMPARY"[6@#100]' myfile.pdf
+  %s list -j 4 -o statements.txt 'statements/*.pdf'
+`, progname, progname, progname)
+}
+
+func show_metadata(out io.Writer, m pdf_parser.Metadata) {
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	fmt.Fprintf(out, "Title: [%s]\n", m.Title)
+	fmt.Fprintf(out, "Author: [%s]\n", m.Author)
+	fmt.Fprintf(out, "Subject: [%s]\n", m.Subject)
+	fmt.Fprintf(out, "Keywords: [%s]\n", m.Keywords)
+	fmt.Fprintf(out, "Creator: [%s]\n", m.Creator)
+	fmt.Fprintf(out, "Producer: [%s]\n", m.Producer)
+	fmt.Fprintf(out, "CreationDate: [%s]\n", date(m.CreationDate))
+	fmt.Fprintf(out, "ModDate: [%s]\n", date(m.ModDate))
+	keys := make([]string, 0, len(m.XMP))
+	for k := range m.XMP {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(out, "%s: [%s]\n", k, m.XMP[k])
+	}
+}
+
+// attachment_name returns a name safe to be used in the output directory, the
+// names come from the PDF and may have a path.
+func attachment_name(name string, index int) string {
+	if i := strings.LastIndexAny(name, `/\`); i != -1 {
+		name = name[i+1:]
+	}
+	if name == "" || name == "." || name == ".." {
+		name = fmt.Sprintf("attachment_%d", index)
+	}
+	return name
 }
 
-func show_elementes(e []string) {
-	for i, v := range e {
-		fmt.Printf("%d: %s\n", i, v)
+func show_outlines(out io.Writer, outlines []pdf_parser.Outline, depth int) {
+	for _, o := range outlines {
+		fmt.Fprintf(out, "%4d: %*s[%s]\n", o.Page, depth*2, "", o.Title)
+		show_outlines(out, o.Kids, depth+1)
 	}
 }
 
@@ -38,8 +86,17 @@ type Cmd string
 
 const (
 	list      Cmd = "list"
-	format    Cmd = "formt"
 	cmd_query Cmd = "query"
+	fields    Cmd = "fields"
+	annots    Cmd = "annots"
+	info      Cmd = "info"
+	attach    Cmd = "attachments"
+	outlines  Cmd = "outlines"
+	inspect   Cmd = "inspect"
+	trace     Cmd = "trace"
+	match     Cmd = "match"
+	suggest   Cmd = "suggest"
+	cmd_repl  Cmd = "repl"
 )
 
 type Cmd_colors string
@@ -49,112 +106,441 @@ const (
 	normal Cmd_colors = "\033[0;0m"
 )
 
-func main() {
-	progname := os.Args[0]
-	progname_ := strings.Split(progname, "/")
-	progname = progname_[len(progname_)-1]
-	var filepath []string
-	i := 1
-	var arg string
-	var cmd Cmd
-	var prev_arg string
-	for ; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "-f":
-			i++
-			filepath = append(filepath, os.Args[i])
-			prev_arg = "-f"
-		case "-list":
-			cmd = list
-			prev_arg = "-list"
-		case "-query":
-			cmd = cmd_query
-			if len(os.Args) < 5 {
-				os.Stderr.WriteString(fmt.Sprintf("ERROR missing query\n"))
-				usage(progname)
-				os.Exit(1)
+// options are the command and its modifiers, the same for every file.
+type options struct {
+	cmd        Cmd
+	arg        string
+	freetext   bool
+	attach_dir string
+	bookmark   string
+	inspect    inspect_options
+	page       int // of trace, 0 for all the pages
+	template   *template.Template
+	templates  *template.Config // to choose the template of each file, -template auto and match
+	suggest    suggest_options
+	explain    bool            // print the ops of the query instead of running it
+	step       bool            // print each op run by the query
+	ctx        context.Context // stops the queries, nil for none
+}
+
+func (o options) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// interrupt_context is done at the first interrupt(Ctrl-C) to stop the
+// queries, the next one kills the program as usual. Only the commands that run
+// queries use it, Ctrl-C kills the others at once.
+func interrupt_context() (context.Context, func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// fingerprint is what the match rules of the templates are checked against.
+func fingerprint(m pdf_parser.Metadata, text []string, page_sizes [][2]float64, fonts []string) template.Document {
+	return template.Document{Producer: m.Producer, Creator: m.Creator, Text: text, PageSizes: page_sizes, Fonts: fonts}
+}
+
+// stdin is where the document is read from with `-f -`.
+var stdin io.Reader = os.Stdin
+
+// stdin_is_pipe is true when the standard input is not a terminal, something
+// like `curl ... | pdf_to_data list`.
+func stdin_is_pipe() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice == 0
+}
+
+// open_document parses the PDF file at `path`, `-` is the standard input.
+// `close` releases the file once the document is not needed anymore.
+func open_document(path string) (pdf pdf_parser.Document, close func(), err error) {
+	var r io.ReaderAt
+	var size int64
+	var data []byte
+	close = func() {}
+	if path == "-" {
+		// NOTE(elias): a pipe can't be read at random, the whole document is kept.
+		data, err = ioutil.ReadAll(stdin)
+		if err != nil {
+			return pdf, close, err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	} else {
+		// the objects are read as needed, big statements are never fully in memory.
+		file, err := os.Open(path)
+		if err != nil {
+			return pdf, close, err
+		}
+		close = func() { file.Close() }
+		stat, err := file.Stat()
+		if err != nil {
+			return pdf, close, err
+		}
+		r, size = file, stat.Size()
+	}
+	pdf, err = pdf_parser.ParseReaderAt(r, size)
+	if xerr, ok := err.(*pdf_parser.XrefError); ok {
+		// NOTE(elias): documents with a broken xref can only be read from the start,
+		// the whole document is then in memory.
+		log.Printf("WARNING: %s: %s, reading the whole document\n", path, strings.TrimSuffix(xerr.Error(), "\n"))
+		if data == nil {
+			data, err = ioutil.ReadFile(path)
+			if err != nil {
+				return pdf, close, err
+			}
+		}
+		pdf, err = pdf_parser.Parse(data, nil, nil)
+	}
+	return pdf, close, err
+}
+
+// text_options applies -bookmark and -freetext to `pdf`, it returns the part of
+// the document used and its text.
+func text_options(pdf pdf_parser.Document, opts options) (pdf_parser.Document, []string, error) {
+	if opts.bookmark != "" {
+		var err error
+		pdf, err = pdf.Bookmark(opts.bookmark)
+		if err != nil {
+			return pdf, nil, err
+		}
+	}
+	if opts.freetext {
+		return pdf, pdf.TextWithAnnotations(), nil
+	}
+	return pdf, pdf.Text, nil
+}
+
+// run executes the command of `opts` on the PDF file at `path`, `-` is the
+// standard input. The result is written to `out`.
+func run(path string, opts options, out io.Writer) error {
+	pdf, close, err := open_document(path)
+	defer close()
+	if err != nil {
+		return err
+	}
+	pdf, text, err := text_options(pdf, opts)
+	if err != nil {
+		return err
+	}
+	switch opts.cmd {
+	case list:
+		for j, v := range text {
+			fmt.Fprintf(out, "%4d: [%s]\n", j, v)
+		}
+	case fields:
+		for _, f := range pdf.Fields {
+			fmt.Fprintf(out, "%s: [%s]\n", f.Name, f.Value)
+		}
+	case annots:
+		for _, a := range pdf.Annotations {
+			fmt.Fprintf(out, "%4d: %s %v [%s]", a.Page, a.Subtype, a.Rect, a.Contents)
+			if a.URI != "" {
+				fmt.Fprintf(out, " %s", a.URI)
+			}
+			fmt.Fprintln(out)
+		}
+	case info:
+		show_metadata(out, pdf.Metadata)
+	case outlines:
+		show_outlines(out, pdf.Outlines, 0)
+	case attach:
+		for j, a := range pdf.Attachments {
+			data, err := pdf.AttachmentData(a)
+			if err != nil {
+				log.Println(err)
+				continue
 			}
-			prev_arg = "-query"
-			i++
-			arg = os.Args[i]
-		case "-format":
-			cmd = format
-			i++
-			arg = os.Args[i]
-			prev_arg = "-format"
-		case "-help", "-h", "--help":
-			usage(progname)
-			os.Exit(0)
-		default:
-			os.Stderr.WriteString(progname)
-			if prev_arg == "-f" {
-				filepath = append(filepath, os.Args[i])
+			fmt.Fprintf(out, "%4d: %s %d bytes [%s] %s\n", j, a.Name, len(data), a.MimeType, a.Description)
+			if opts.attach_dir == "" {
 				continue
 			}
-			spaces := len(progname)
-			for j, o := range os.Args[1:] {
-				var err_b, err_e Cmd_colors
-				if j == i-1 {
-					err_b = red
-					err_e = normal
-				}
-				os.Stderr.WriteString(fmt.Sprintf("%s%s%s", err_b, o, err_e))
-				if j < len(os.Args[1:]) {
-					os.Stderr.WriteString(" ")
+			if err := os.MkdirAll(opts.attach_dir, 0755); err != nil {
+				return err
+			}
+			path := opts.attach_dir + "/" + attachment_name(a.Name, j)
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "      written to %s\n", path)
+		}
+	case inspect:
+		return show_inspect(out, pdf, opts.inspect)
+	case trace:
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		return pdf.Trace(opts.page, func(e pdf_parser.TraceEvent) {
+			enc.Encode(e)
+		})
+	case suggest:
+		return show_suggest(opts.context(), out, path, text, opts.suggest)
+	case match:
+		for _, s := range opts.templates.Scores(fingerprint(pdf.Metadata, pdf.Text, pdf.PageSizes(), pdf.Fonts())) {
+			fmt.Fprintf(out, "%.2f %s", s.Confidence, s.Template.Name)
+			if len(s.Missing) > 0 {
+				fmt.Fprintf(out, ", missing: %s", strings.Join(s.Missing, ", "))
+			}
+			fmt.Fprintln(out)
+		}
+	case cmd_query:
+		tmpl := opts.template
+		if opts.templates != nil {
+			s, err := opts.templates.Select(fingerprint(pdf.Metadata, pdf.Text, pdf.PageSizes(), pdf.Fonts()))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%s: template %s, confidence %.2f\n", path, s.Template.Name, s.Confidence)
+			tmpl = &s.Template
+		}
+		if tmpl != nil && opts.step {
+			return show_steps(opts.context(), out, tmpl.Query, text)
+		}
+		if tmpl != nil {
+			q, err := query.ParseQuery(tmpl.Query)
+			if err != nil {
+				return errors.New(fmt.Sprintf("template %s: %s", tmpl.Name, err))
+			}
+			result, err := query.RunQueryContext(opts.context(), q, text)
+			if err != nil {
+				return err
+			}
+			return tmpl.Write(out, result)
+		}
+		if opts.step {
+			return show_steps(opts.context(), out, opts.arg, text)
+		}
+		q, err := query.ParseQuery(opts.arg)
+		if err != nil {
+			return err
+		}
+		result, err := query.RunQueryContext(opts.context(), q, text)
+		for _, l := range result {
+			for i, el := range l {
+				fmt.Fprint(out, el)
+				if i < len(l)-1 {
+					fmt.Fprint(out, "\t")
 				}
-				spaces += len(o)
 			}
-			spaces -= len(os.Args[i])
-			os.Stderr.WriteString(fmt.Sprintf("\n%*s%s^^^%s", spaces, "", red, normal))
-			os.Stderr.WriteString(fmt.Sprintf("Unkwon option %s\n", os.Args[i]))
-			usage(progname)
-			os.Exit(1)
+			fmt.Fprintln(out)
+		}
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func main() {
+	progname := os.Args[0]
+	progname_ := strings.Split(progname, "/")
+	progname = progname_[len(progname_)-1]
+	os.Exit(run_main(progname, os.Args[1:]))
+}
 
-	if len(filepath) < 1 {
-		os.Stderr.WriteString(fmt.Sprintf("Missing %s-f <filepath>%s\n", red, normal))
-		usage(progname)
-		os.Exit(1)
+// run_main runs the command of the arguments `args` and returns the exit code.
+func run_main(progname string, args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr, progname)
+		return exit_usage
 	}
-	for i := range filepath {
-		file, err := ioutil.ReadFile(filepath[i])
-		if err != nil {
-			log.Fatalln(err)
+	switch args[0] {
+	case "-help", "-h", "--help":
+		usage(os.Stdout, progname)
+		return exit_ok
+	case "help":
+		if len(args) == 1 {
+			usage(os.Stdout, progname)
+			return exit_ok
 		}
-		pdf, err := pdf_parser.Parse(file, nil, nil)
-		if err != nil {
-			fmt.Print(err)
-			os.Exit(1)
+		c := find_command(args[1])
+		if c == nil {
+			show_arg_error(os.Stderr, progname, args, 1, errors.New(fmt.Sprintf("Unknown command %s", args[1])))
+			return exit_usage
+		}
+		c.usage(os.Stdout, progname)
+		return exit_ok
+	}
+	c := find_command(args[0])
+	if c == nil {
+		show_arg_error(os.Stderr, progname, args, 0, errors.New(fmt.Sprintf("Unknown command %s", args[0])))
+		usage(os.Stderr, progname)
+		return exit_usage
+	}
+	for _, a := range args[1:] {
+		if a == "-help" || a == "-h" || a == "--help" {
+			c.usage(os.Stdout, progname)
+			return exit_ok
 		}
+		if a == "--" {
+			break
+		}
+	}
 
-		switch cmd {
-		case list:
-			for j, v := range pdf.Text {
-				fmt.Printf("%4d: [%s]\n", j, v)
-			}
-		case cmd_query:
-			q, err := query.ParseQuery(arg)
-			if err != nil {
-				log.Fatalln(err)
+	flags, positional, inputs, err := c.parse_args(args[1:])
+	if err != nil {
+		show_arg_error(os.Stderr, progname, args, err.(*arg_error).index+1, err)
+		c.usage(os.Stderr, progname)
+		return exit_usage
+	}
+	opts, files, err := c.options(flags, positional)
+	if err != nil {
+		show_arg_error(os.Stderr, progname, args, len(args), err)
+		c.usage(os.Stderr, progname)
+		return exit_usage
+	}
+	inputs = append(inputs, files...)
+	if c.cmd == cmd_query && opts.arg != "" {
+		// the query is checked once for all the files, with where it is wrong
+		if _, err := query.ParseQuery(opts.arg); err != nil {
+			index := 1
+			for index < len(args)-1 && args[index] != opts.arg {
+				index++
 			}
-			result, err := query.RunQuery(q, pdf.Text)
-			for _, l := range result {
-				for i, el := range l {
-					fmt.Print(el)
-					if i < len(l)-1 {
-						fmt.Print("\t")
-					}
-				}
-				fmt.Println()
+			prefix := strings.Join(append([]string{progname}, args[:index]...), " ") + " "
+			suffix := ""
+			if index < len(args)-1 {
+				suffix = " " + strings.Join(args[index+1:], " ")
 			}
+			show_query_error(os.Stderr, prefix, opts.arg, suffix, err)
+			return exit_usage
+		}
+	}
+	if name, ok := flags["template"]; ok || c.cmd == match {
+		path := flags["config"]
+		if path == "" {
+			path = template.DefaultPath()
+		}
+		config, err := template.Load(path)
+		if err != nil {
+			log.Println(err)
+			return exit_fail
+		}
+		if name == "auto" || c.cmd == match {
+			opts.templates = &config
+		} else {
+			t, err := config.Find(name)
 			if err != nil {
-				log.Fatalf("Query `%s` did not find any entry\n", err)
+				log.Println(err)
+				return exit_fail
 			}
-		default:
-			os.Stderr.WriteString(fmt.Sprintf("Missing %s<cmd>%s\n", red, normal))
-			usage(progname)
-			os.Exit(1)
+			if _, err := query.ParseQuery(t.Query); err != nil {
+				show_query_error(os.Stderr, fmt.Sprintf("%s: template %s: ", path, name), t.Query, "", err)
+				return exit_fail
+			}
+			opts.template = &t
+		}
+	}
+	if opts.explain {
+		q := opts.arg
+		if opts.template != nil {
+			q = opts.template.Query
+		} else if opts.templates != nil {
+			log.Println("ERROR: -explain needs a query or -template <name>, the template of auto depends on the document")
+			return exit_usage
+		}
+		if err := query.Explain(os.Stdout, q); err != nil {
+			log.Println(err)
+			return exit_fail
+		}
+		return exit_ok
+	}
+	workers := runtime.NumCPU()
+	if j, ok := flags["j"]; ok {
+		// already checked by check_workers
+		workers, _ = strconv.Atoi(j)
+	}
+	_, strict := flags["strict"]
+	output := flags["o"]
+
+	if len(inputs) < 1 && stdin_is_pipe() && c.cmd != cmd_repl {
+		inputs = append(inputs, "-")
+	}
+	if len(inputs) < 1 {
+		os.Stderr.WriteString(fmt.Sprintf("Missing %s<filepath>%s\n", red, normal))
+		c.usage(os.Stderr, progname)
+		return exit_usage
+	}
+	files, batch, err := expand(inputs)
+	if err != nil {
+		log.Println(err)
+		return exit_fail
+	}
+	if batch && c.cmd == suggest {
+		log.Println("ERROR: suggest works on a single document")
+		return exit_usage
+	}
+	if c.cmd == cmd_repl {
+		if output != "" {
+			log.Println("ERROR: the REPL writes to the standard output, -o can't be used")
+			return exit_usage
+		}
+		r, err := new_repl(files, opts, stdin, os.Stdout, repl_history_path())
+		if err != nil {
+			log.Println(err)
+			return exit_fail
 		}
+		r.run()
+		return exit_ok
+	}
+	var out io.Writer = os.Stdout
+	var tmp *os.File
+	if output != "" {
+		// the result goes to a temporary file in the same directory, renamed to
+		// output at the end, so output is never left half written.
+		tmp, err = ioutil.TempFile(filepath.Dir(output), "."+filepath.Base(output)+".*")
+		if err != nil {
+			log.Println(err)
+			return exit_fail
+		}
+		out = tmp
+	}
+	if c.cmd == cmd_query || c.cmd == suggest {
+		ctx, stop := interrupt_context()
+		defer stop()
+		opts.ctx = ctx
+	}
+	failed := 0
+	if batch {
+		failed = run_batch(files, opts, workers, out, os.Stderr)
+	} else if err := run(files[0], opts, out); err != nil {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		log.Println(err)
+		return exit_fail
+	}
+	if tmp != nil {
+		if err := commit_output(tmp, output); err != nil {
+			log.Println(err)
+			return exit_fail
+		}
+	}
+	if failed > 0 && strict || opts.context().Err() != nil {
+		return exit_fail
+	}
+	return exit_ok
+}
+
+// commit_output replaces `output` with the temporary file `tmp`.
+func commit_output(tmp *os.File, output string) error {
+	err := tmp.Sync()
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), output)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
 	}
+	return err
 }
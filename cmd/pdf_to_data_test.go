@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	pdf_parser "pdf_to_data/lib/pdf"
 	"pdf_to_data/lib/query"
+	"pdf_to_data/lib/template"
+	"strings"
 	"testing"
 )
 
@@ -54,3 +60,371 @@ func TestQuery(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestAttachmentName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"statement.csv":        "statement.csv",
+		"../../etc/passwd":     "passwd",
+		`C:\Users\ana\ofx.ofx`: "ofx.ofx",
+		"..":                   "attachment_3",
+		"":                     "attachment_3",
+	} {
+		if s := attachment_name(name, 3); s != expected {
+			log.Printf("`%s`: expected `%s`, found `%s`\n", name, expected, s)
+			t.Fail()
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	log.SetPrefix("TestBatch: ")
+	dir, err := ioutil.TempDir("", "pdf_to_data")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+	sample, err := ioutil.ReadFile("../sample/pdf_example.pdf")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, name := range []string{"b.pdf", "a.PDF"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), sample, 0644); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		log.Fatalln(err)
+	}
+
+	files, batch, err := expand([]string{dir})
+	if err != nil || !batch || len(files) != 2 || filepath.Base(files[0]) != "a.PDF" {
+		log.Printf("expand(%s) = %v %v %v\n", dir, files, batch, err)
+		t.Fail()
+	}
+	if files, batch, _ := expand([]string{filepath.Join(dir, "b.pdf")}); batch || len(files) != 1 {
+		log.Printf("a single file is not a batch, got %v %v\n", files, batch)
+		t.Fail()
+	}
+	if _, _, err := expand([]string{filepath.Join(dir, "*.xls")}); err == nil {
+		log.Printf("a pattern without matches must fail\n")
+		t.Fail()
+	}
+
+	var out, summary bytes.Buffer
+	files = append(files, filepath.Join(dir, "missing.pdf"))
+	failed := run_batch(files, options{cmd: list}, 2, &out, &summary)
+	if failed != 1 || !strings.Contains(summary.String(), "FAIL "+files[2]) || !strings.Contains(summary.String(), "3 files, 2 ok, 1 failed") {
+		log.Printf("expected missing.pdf to fail, got %d:\n%s", failed, summary.String())
+		t.Fail()
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], files[0]+":    0: [") || !strings.HasPrefix(lines[len(lines)-1], files[1]+": ") {
+		log.Printf("the results are not in order or without the file name:\n%s", out.String())
+		t.Fail()
+	}
+}
+
+func TestBatchMalformed(t *testing.T) {
+	log.SetPrefix("TestBatchMalformed: ")
+	dir, err := ioutil.TempDir("", "pdf_to_data")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+	files := []string{filepath.Join(dir, "hex.pdf"), filepath.Join(dir, "endobj.pdf"), filepath.Join(dir, "operator.pdf"), "../sample/pdf_example.pdf"}
+	for i, doc := range []string{
+		"%PDF-1.4\n1 0 obj\n<ab\n",
+		"%PDF-1.4\nendobj\n",
+		"%PDF-1.4\n<< '\n", // panics in the operators
+	} {
+		if err := ioutil.WriteFile(files[i], []byte(doc), 0644); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	var out, summary bytes.Buffer
+	failed := run_batch(files, options{cmd: list}, 2, &out, &summary)
+	for _, expected := range []string{
+		"FAIL " + files[0] + ": ERROR:3:1 expected token `>`, found EOF",
+		"FAIL " + files[1] + ": ERROR:2:1 unexpected `endobj`",
+		"FAIL " + files[2] + ": ERROR: ",
+		"OK   " + files[3],
+		"4 files, 1 ok, 3 failed",
+	} {
+		if !strings.Contains(summary.String(), expected) {
+			log.Printf("expected `%s` in the summary:\n%s", expected, summary.String())
+			t.Fail()
+		}
+	}
+	if failed != 3 || !strings.HasPrefix(out.String(), files[3]+":    0: [") {
+		log.Printf("expected the text of %s, %d failed:\n%s", files[3], failed, out.String())
+		t.Fail()
+	}
+}
+
+func TestBatchInterrupt(t *testing.T) {
+	log.SetPrefix("TestBatchInterrupt: ")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	files := []string{"../sample/pdf_example.pdf", "../sample/pdf_example.pdf"}
+	var out, summary bytes.Buffer
+	failed := run_batch(files, options{cmd: cmd_query, arg: `@"START"[3]`, ctx: ctx}, 2, &out, &summary)
+	if failed != 0 || out.Len() != 0 || !strings.Contains(summary.String(), "2 files, 0 ok, 0 failed, 2 skipped after the interrupt") {
+		log.Printf("expected no file to run, %d failed:\n%s%s", failed, out.String(), summary.String())
+		t.Fail()
+	}
+}
+
+func TestOpenDocument(t *testing.T) {
+	log.SetPrefix("TestOpenDocument: ")
+	defer func() { stdin = os.Stdin }()
+	// without xref the document is read from the start
+	stdin = strings.NewReader("%PDF-1.4\n1 0 obj\n<</Type/Catalog>>\nendobj\n")
+	if _, close, err := open_document("-"); err != nil {
+		log.Printf("expected the document to be read without xref, found %v\n", err)
+		t.Fail()
+	} else {
+		close()
+	}
+	// the other errors are not hidden by reading it again
+	stdin = strings.NewReader("hello")
+	_, close, err := open_document("-")
+	close()
+	if err == nil || !strings.Contains(err.Error(), "%PDF-") {
+		log.Printf("expected the error of the header, found %v\n", err)
+		t.Fail()
+	}
+}
+
+func TestStdinOutput(t *testing.T) {
+	log.SetPrefix("TestStdinOutput: ")
+	sample, err := ioutil.ReadFile("../sample/pdf_example.pdf")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var from_file, from_stdin bytes.Buffer
+	if err := run("../sample/pdf_example.pdf", options{cmd: list}, &from_file); err != nil {
+		log.Fatalln(err)
+	}
+	stdin = bytes.NewReader(sample)
+	defer func() { stdin = os.Stdin }()
+	if err := run("-", options{cmd: list}, &from_stdin); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if from_stdin.String() != from_file.String() {
+		log.Printf("expected the same text from the standard input, got:\n%s", from_stdin.String())
+		t.Fail()
+	}
+
+	dir, err := ioutil.TempDir("", "pdf_to_data")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "out.txt")
+	tmp, err := ioutil.TempFile(dir, ".out.txt.*")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tmp.WriteString(from_file.String())
+	if err := commit_output(tmp, output); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	written, err := ioutil.ReadFile(output)
+	entries, _ := ioutil.ReadDir(dir)
+	if err != nil || string(written) != from_file.String() || len(entries) != 1 {
+		log.Printf("expected only %s with the result, got %d files: %v\n", output, len(entries), err)
+		t.Fail()
+	}
+
+	// a usage error leaves no temporary file behind
+	os.Remove(output)
+	args := []string{"suggest", "-row", "a", "-o", output, "../sample/pdf_example.pdf", "../sample/pdf_example.pdf"}
+	if code := run_main("pdf_to_data", args); code != exit_usage {
+		log.Printf("expected the exit code %d, found %d\n", exit_usage, code)
+		t.Fail()
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		log.Printf("expected no file in %s, found %d\n", dir, len(entries))
+		t.Fail()
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	log.SetPrefix("TestParseArgs: ")
+	c := find_command("query")
+	flags, positional, files, err := c.parse_args([]string{"-j", "2", "@#1[2]", "-f", "a.pdf", "-freetext", "--", "-b.pdf"})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	opts, inputs, err := c.options(flags, positional)
+	if err != nil || opts.cmd != cmd_query || opts.arg != "@#1[2]" || !opts.freetext || flags["j"] != "2" ||
+		len(files) != 1 || files[0] != "a.pdf" || len(inputs) != 1 || inputs[0] != "-b.pdf" {
+		log.Printf("unexpected %v %v %v %v %v\n", opts, flags, files, inputs, err)
+		t.Fail()
+	}
+
+	for _, test := range []struct {
+		args  []string
+		index int
+	}{
+		{[]string{"a.pdf", "-list"}, 1},
+		{[]string{"-j", "0", "a.pdf"}, 1},
+		{[]string{"a.pdf", "-bookmark"}, 1},
+	} {
+		_, _, _, err := c.parse_args(test.args)
+		if e, ok := err.(*arg_error); !ok || e.index != test.index {
+			log.Printf("%v: expected an error at %d, got %v\n", test.args, test.index, err)
+			t.Fail()
+		}
+	}
+	if _, _, err := c.options(map[string]string{}, nil); err == nil {
+		log.Printf("expected the query to be missing\n")
+		t.Fail()
+	}
+	if code := run_main("pdf_to_data", []string{"lst", "a.pdf"}); code != exit_usage {
+		log.Printf("expected exit code %d for an unknown command, got %d\n", exit_usage, code)
+		t.Fail()
+	}
+	if code := run_main("pdf_to_data", []string{"list", "../sample/missing.pdf"}); code != exit_fail {
+		log.Printf("expected exit code %d for a missing file, got %d\n", exit_fail, code)
+		t.Fail()
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	log.SetPrefix("TestTemplate: ")
+	config, err := template.Load("../sample/templates.json")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tmpl, err := config.Find("example")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var out bytes.Buffer
+	if err := run("../sample/pdf_example.pdf", options{cmd: cmd_query, template: &tmpl}, &out); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	expected := "date,description,amount\n01-06,Some Stuff,10\n02-03,This happened,32\n03-10,Other thing,75\n"
+	if out.String() != expected {
+		log.Printf("expected\n%s\nfound\n%s", expected, out.String())
+		t.Fail()
+	}
+}
+
+func TestTemplateAuto(t *testing.T) {
+	log.SetPrefix("TestTemplateAuto: ")
+	config, err := template.Load("../sample/templates.json")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var out bytes.Buffer
+	if err := run("../sample/pdf_example.pdf", options{cmd: match, templates: &config}, &out); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if !strings.HasPrefix(out.String(), "1.00 example\n0.00 letter") {
+		log.Printf("unexpected scores:\n%s", out.String())
+		t.Fail()
+	}
+	out.Reset()
+	if err := run("../sample/pdf_example.pdf", options{cmd: cmd_query, templates: &config}, &out); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if !strings.HasPrefix(out.String(), "date,description,amount\n01-06,Some Stuff,10\n") {
+		log.Printf("unexpected result:\n%s", out.String())
+		t.Fail()
+	}
+}
+
+func TestQueryContext(t *testing.T) {
+	log.SetPrefix("TestQueryContext: ")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var out bytes.Buffer
+	err := run("../sample/pdf_example.pdf", options{cmd: cmd_query, arg: `@"START"[3]`, ctx: ctx}, &out)
+	if err != context.Canceled {
+		log.Printf("expected %v, found %v\n", context.Canceled, err)
+		t.Fail()
+	}
+	// the errors of the VM are not hidden
+	err = run("../sample/pdf_example.pdf", options{cmd: cmd_query, arg: `#999`}, &out)
+	if err == nil || !strings.HasPrefix(err.Error(), "ERROR: #999 is past the last item") {
+		log.Printf("unexpected error %v\n", err)
+		t.Fail()
+	}
+}
+
+func TestRepl(t *testing.T) {
+	log.SetPrefix("TestRepl: ")
+	in := strings.NewReader(":find end\n@\"START\"[3]\n@\"START\"+[2]\n!1\n:doc 3\n:quit\n:list\n")
+	var out bytes.Buffer
+	r, err := new_repl([]string{"../sample/pdf_example.pdf"}, options{}, in, &out, "")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	r.run()
+	for _, expected := range []string{
+		"  15: [END]\n1 items\n",
+		"> 0  20 ",
+		"3  75 ",
+		"expected a number after `+`, found `[`\n",
+		"> :find end\n  15: [END]\n",
+		"ERROR: no document 3",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			log.Printf("expected `%s` in\n%s", expected, out.String())
+			t.Fail()
+		}
+	}
+	if strings.Contains(out.String(), "[Table 1") {
+		log.Printf(":list ran after :quit\n%s", out.String())
+		t.Fail()
+	}
+	if len(r.history) != 6 {
+		log.Printf("expected 6 lines in the history, found %v\n", r.history)
+		t.Fail()
+	}
+}
+
+func TestReplHistory(t *testing.T) {
+	log.SetPrefix("TestReplHistory: ")
+	dir, err := ioutil.TempDir("", "pdf_to_data")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+	var lines []string
+	for i := 0; i < repl_history_size+10; i++ {
+		lines = append(lines, fmt.Sprintf("#%d", i))
+	}
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	var out bytes.Buffer
+	r, err := new_repl([]string{"../sample/pdf_example.pdf"}, options{}, strings.NewReader(":docs\n"), &out, path)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	r.run()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	expected := strings.Join(append(lines[10:], ":docs"), "\n") + "\n"
+	if string(data) != expected {
+		log.Printf("expected the last %d lines and :docs in the history file, found %d lines\n", repl_history_size, strings.Count(string(data), "\n"))
+		t.Fail()
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"pdf_to_data/lib/query"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// The REPL keeps the documents in memory to write a query by trial and error
+// without parsing the PDF at each try. A line is a query unless it is one of
+// the commands of repl_help.
+
+const repl_prompt = "> "
+
+// repl_page is the number of items shown by :list.
+const repl_page = 20
+
+// repl_history_size is the number of lines kept in the history file, the older
+// ones are removed when the REPL starts.
+const repl_history_size = 500
+
+const repl_help = `:list [index]   show the text from index, or where the last :list stopped
+:find <text>    show the items with the text, the case is ignored
+:docs           list the documents, * is the one the queries run on
+:doc <n>        run the queries on the document n
+:open <file>    read another document and run the queries on it
+:explain <q>    show the ops the query q is compiled to
+:step <q>       run the query q showing each op, the index and item after it
+:history        show the previous lines
+!<n>            run the line n of the history again
+:help           show this help
+:quit           exit, like the end of the input
+anything else is a query, like '@"START"[3@"END"]'
+`
+
+type repl_doc struct {
+	path string
+	text []string
+}
+
+type repl struct {
+	docs         []repl_doc
+	cur          int // the document the queries run on
+	pos          int // where :list continues
+	opts         options
+	history      []string
+	history_path string // "" to not keep the history between sessions
+	in           *bufio.Reader
+	out          io.Writer
+}
+
+// repl_history_path is where the lines of the REPL are kept between sessions,
+// "" when there is no user config dir.
+func repl_history_path() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pdf_to_data", "history")
+}
+
+// load_text reads the document at `path` and returns its text with the text
+// flags of `opts`.
+func load_text(path string, opts options) ([]string, error) {
+	pdf, close, err := open_document(path)
+	defer close()
+	if err != nil {
+		return nil, err
+	}
+	_, text, err := text_options(pdf, opts)
+	return text, err
+}
+
+// new_repl reads the documents `files`, the commands come from `in`.
+func new_repl(files []string, opts options, in io.Reader, out io.Writer, history_path string) (*repl, error) {
+	r := &repl{opts: opts, history_path: history_path, in: bufio.NewReader(in), out: out}
+	for _, path := range files {
+		if path == "-" {
+			return nil, errors.New("ERROR: the standard input is read by the REPL, the documents must be files")
+		}
+		if err := r.open(path); err != nil {
+			return nil, err
+		}
+	}
+	r.cur = 0
+	if history_path != "" {
+		// a missing file is a first session
+		if data, err := ioutil.ReadFile(history_path); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if line != "" {
+					r.history = append(r.history, line)
+				}
+			}
+		}
+		if len(r.history) > repl_history_size {
+			r.history = r.history[len(r.history)-repl_history_size:]
+			// NOTE(elias): add_history only appends, the file is cut here.
+			ioutil.WriteFile(history_path, []byte(strings.Join(r.history, "\n")+"\n"), 0644)
+		}
+	}
+	return r, nil
+}
+
+// open reads the document at `path` and makes it the current one.
+func (r *repl) open(path string) error {
+	text, err := load_text(path, r.opts)
+	if err != nil {
+		return errors.New(fmt.Sprintf("ERROR: %s: %s", path, err))
+	}
+	r.docs = append(r.docs, repl_doc{path, text})
+	r.cur, r.pos = len(r.docs)-1, 0
+	return nil
+}
+
+// run reads the lines until :quit or the end of the input.
+func (r *repl) run() {
+	fmt.Fprintf(r.out, "%d documents, %s has %d items, :help for the commands\n", len(r.docs), r.docs[r.cur].path, len(r.docs[r.cur].text))
+	for {
+		fmt.Fprint(r.out, repl_prompt)
+		line, err := r.in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" && err != nil {
+			fmt.Fprintln(r.out)
+			return
+		}
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			n, perr := strconv.Atoi(line[1:])
+			if perr != nil || n < 1 || n > len(r.history) {
+				fmt.Fprintf(r.out, "ERROR: no line %s in the history\n", line[1:])
+				continue
+			}
+			line = r.history[n-1]
+			fmt.Fprintln(r.out, line)
+		}
+		r.add_history(line)
+		if !r.exec(line) {
+			return
+		}
+	}
+}
+
+func (r *repl) add_history(line string) {
+	if len(r.history) > 0 && r.history[len(r.history)-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	if r.history_path == "" {
+		return
+	}
+	// NOTE(elias): the history is a convenience, failing to write it doesn't stop the REPL.
+	if err := os.MkdirAll(filepath.Dir(r.history_path), 0755); err != nil {
+		return
+	}
+	file, err := os.OpenFile(r.history_path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, line)
+}
+
+// exec runs the line, it returns false to exit.
+func (r *repl) exec(line string) bool {
+	if !strings.HasPrefix(line, ":") {
+		r.query(line)
+		return true
+	}
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i != -1 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	doc := r.docs[r.cur]
+	switch name {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help", ":h":
+		fmt.Fprint(r.out, repl_help)
+	case ":list", ":l":
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 || n >= len(doc.text) {
+				fmt.Fprintf(r.out, "ERROR: invalid index %s, the document has %d items\n", arg, len(doc.text))
+				return true
+			}
+			r.pos = n
+		}
+		if r.pos >= len(doc.text) {
+			r.pos = 0
+		}
+		end := r.pos + repl_page
+		if end > len(doc.text) {
+			end = len(doc.text)
+		}
+		for j := r.pos; j < end; j++ {
+			fmt.Fprintf(r.out, "%4d: [%s]\n", j, doc.text[j])
+		}
+		r.pos = end
+		if end < len(doc.text) {
+			fmt.Fprintf(r.out, "-- %d/%d, :list for more --\n", end, len(doc.text))
+		}
+	case ":find", ":f":
+		if arg == "" {
+			fmt.Fprintln(r.out, "ERROR: :find needs a text")
+			return true
+		}
+		found := 0
+		for j, v := range doc.text {
+			if strings.Contains(strings.ToLower(v), strings.ToLower(arg)) {
+				fmt.Fprintf(r.out, "%4d: [%s]\n", j, v)
+				found++
+			}
+		}
+		fmt.Fprintf(r.out, "%d items\n", found)
+	case ":docs":
+		for j, d := range r.docs {
+			mark := " "
+			if j == r.cur {
+				mark = "*"
+			}
+			fmt.Fprintf(r.out, "%s%d: %s, %d items\n", mark, j, d.path, len(d.text))
+		}
+	case ":doc":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 || n >= len(r.docs) {
+			fmt.Fprintf(r.out, "ERROR: no document %s, see :docs\n", arg)
+			return true
+		}
+		r.cur, r.pos = n, 0
+	case ":open":
+		if arg == "" {
+			fmt.Fprintln(r.out, "ERROR: :open needs a file")
+			return true
+		}
+		if err := r.open(arg); err != nil {
+			fmt.Fprintln(r.out, err)
+			return true
+		}
+		fmt.Fprintf(r.out, "%s has %d items\n", arg, len(r.docs[r.cur].text))
+	case ":explain", ":step":
+		if arg == "" {
+			fmt.Fprintf(r.out, "ERROR: %s needs a query\n", name)
+			return true
+		}
+		var err error
+		if name == ":explain" {
+			err = query.Explain(r.out, arg)
+		} else {
+			ctx, stop := interrupt_context()
+			err = show_steps(ctx, r.out, arg, doc.text)
+			stop()
+		}
+		if err != nil {
+			show_query_error(r.out, "", arg, "", err)
+		}
+	case ":history":
+		for j, h := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", j+1, h)
+		}
+	default:
+		fmt.Fprintf(r.out, "ERROR: unknown command %s, :help for the commands\n", name)
+	}
+	return true
+}
+
+// query runs `q` on the current document and shows the rows as a table.
+func (r *repl) query(q string) {
+	ops, err := query.ParseQuery(q)
+	if err != nil {
+		show_query_error(r.out, "", q, "", err)
+		return
+	}
+	// NOTE(elias): Ctrl-C stops the query and goes back to the prompt.
+	ctx, stop := interrupt_context()
+	result, err := query.RunQueryContext(ctx, ops, r.docs[r.cur].text)
+	stop()
+	w := tabwriter.NewWriter(r.out, 0, 4, 2, ' ', 0)
+	for j, l := range result {
+		fmt.Fprintf(w, "%d\t%s\n", j, strings.Join(l, "\t"))
+	}
+	w.Flush()
+	fmt.Fprintf(r.out, "%d rows\n", len(result))
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"pdf_to_data/lib/query"
+	"pdf_to_data/lib/template"
+	"strings"
+)
+
+// suggest_options are the example row and the section it is in, to write a
+// query from them.
+type suggest_options struct {
+	row    []string
+	start  string
+	end    string
+	save   string // name of the template to save the query as
+	config string // the templates file
+}
+
+// show_suggest writes the query for the example row, the rows it prints and
+// saves it as a template. Without -save the name is asked when the document
+// was not read from the standard input.
+func show_suggest(ctx context.Context, out io.Writer, path string, text []string, opts suggest_options) error {
+	q, warnings, err := template.Suggest(text, opts.row, opts.start, opts.end)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "query: %s\n", q)
+	for _, w := range warnings {
+		fmt.Fprintf(out, "warning: %s\n", w)
+	}
+	ops, err := query.ParseQuery(q)
+	if err != nil {
+		return err
+	}
+	result, err := query.RunQueryContext(ctx, ops, text)
+	fmt.Fprintf(out, "rows:\n")
+	for _, l := range result {
+		fmt.Fprintf(out, "  %s\n", strings.Join(l, "\t"))
+	}
+	if err != nil {
+		fmt.Fprintf(out, "warning: %s\n", err)
+	}
+
+	name := opts.save
+	if name == "" && path != "-" && !stdin_is_pipe() {
+		// NOTE(elias): `out` may be the file of -o, the question is not part of the result.
+		fmt.Fprintf(os.Stderr, "Name of the template to save the query in %s, empty to skip: ", opts.config)
+		line, _ := bufio.NewReader(stdin).ReadString('\n')
+		name = strings.TrimSpace(line)
+	}
+	if name == "" {
+		return nil
+	}
+	config, err := template.Load(opts.config)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	columns := make([]template.Column, len(opts.row))
+	for i := range columns {
+		columns[i].Name = fmt.Sprintf("column_%d", i+1)
+	}
+	config.Add(template.Template{Name: name, Query: q, Columns: columns})
+	if err := config.Save(opts.config); err != nil {
+		return errors.New(fmt.Sprintf("ERROR: could not save the template %s: %s", name, err))
+	}
+	fmt.Fprintf(out, "saved as the template %s in %s\n", name, opts.config)
+	return nil
+}
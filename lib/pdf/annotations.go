@@ -0,0 +1,88 @@
+package pdf
+
+// Annotation is an annotation of a page(/Annots): comments(Text, FreeText,
+// Popup), links, form widgets…
+type Annotation struct {
+	Page     int // starting at 1
+	Subtype  string
+	Rect     [4]float64 // lower-left x, y and upper-right x, y
+	Contents string
+	URI      string // the URI of the /A action of links
+	page     obj_int
+}
+
+func (p *pdf) annotations() []Annotation {
+	var result []Annotation
+	for n, pg := range p.pages() {
+		for _, o := range p.resolve_array(pg.dict["Annots"]) {
+			dict := p.resolve_dict(o)
+			if dict == nil {
+				continue
+			}
+			a := Annotation{Page: n + 1, page: pg.id}
+			if subtype, ok := dict["Subtype"].Type.(obj_named); ok {
+				a.Subtype = string(subtype)
+			}
+			if rect := p.resolve_array(dict["Rect"]); len(rect) == 4 {
+				for i := range rect {
+					a.Rect[i], _ = p.resolve_number(rect[i])
+				}
+				// any two opposite corners may be used
+				if a.Rect[0] > a.Rect[2] {
+					a.Rect[0], a.Rect[2] = a.Rect[2], a.Rect[0]
+				}
+				if a.Rect[1] > a.Rect[3] {
+					a.Rect[1], a.Rect[3] = a.Rect[3], a.Rect[1]
+				}
+			}
+			a.Contents, _ = p.resolve_text(dict["Contents"])
+			if a.Contents == "" && a.Subtype == "Popup" {
+				// the text of a popup is the one of the annotation it belongs
+				a.Contents, _ = p.resolve_text(p.resolve_dict(dict["Parent"])["Contents"])
+			}
+			if action := p.resolve_dict(dict["A"]); action["S"].Type == obj_named("URI") {
+				a.URI, _ = p.resolve_text(action["URI"])
+			}
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// TextWithAnnotations returns Text with the content of the FreeText annotations
+// added before the first text of the page below the top of the annotation.
+func (p pdf) TextWithAnnotations() []string {
+	before := map[int][]string{} // index of Text to the annotations added before it
+	for _, a := range p.Annotations {
+		if a.Subtype != "FreeText" || a.Contents == "" {
+			continue
+		}
+		index := len(p.Text)
+		last := -1
+		for i, pos := range p.text_pos {
+			if pos.page != a.page {
+				continue
+			}
+			if pos.y < a.Rect[3] {
+				index = i
+				break
+			}
+			last = i
+		}
+		if index == len(p.Text) && last != -1 {
+			index = last + 1
+		}
+		before[index] = append(before[index], a.Contents)
+	}
+	if len(before) == 0 {
+		return p.Text
+	}
+	result := make([]string, 0, len(p.Text)+len(before))
+	for i := 0; i <= len(p.Text); i++ {
+		result = append(result, before[i]...)
+		if i < len(p.Text) {
+			result = append(result, p.Text[i])
+		}
+	}
+	return result
+}
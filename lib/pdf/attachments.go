@@ -0,0 +1,88 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Attachment is a file embedded in the document, from /EmbeddedFiles of the
+// catalog or a FileAttachment annotation.
+type Attachment struct {
+	Name        string
+	Description string
+	MimeType    string
+	Page        int     // page of the FileAttachment annotation, 0 for the ones of the document
+	id          obj_int // the EmbeddedFile stream, decoded by AttachmentData
+}
+
+// AttachmentData decodes the content of the attachment `a`. The attachments
+// are only decoded when asked, a document may have many big ones.
+func (p pdf) AttachmentData(a Attachment) ([]byte, error) {
+	stream, err := p.lookup(a.id)
+	if err == nil {
+		var data []byte
+		if data, err = p.decode_stream(stream); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("ERROR: failed to decode the attachment `%s`: %s", a.Name, err))
+}
+
+func (p *pdf) attachments() []Attachment {
+	var result []Attachment
+	seen := map[obj_int]bool{} // the same file may be in the name tree and in an annotation
+	// `name` is used when the file specification doesn't have a file name
+	add := func(filespec obj, name, description string, page int) {
+		spec := p.resolve_dict(filespec)
+		if spec == nil {
+			return
+		}
+		ef := p.resolve_dict(spec["EF"])
+		o, ok := ef["UF"]
+		if !ok {
+			o = ef["F"]
+		}
+		ref, ok := o.Type.(obj_ref)
+		if !ok || seen[ref.id] {
+			return
+		}
+		seen[ref.id] = true
+		stream, ok := p.resolve(o).Type.(obj_ind)
+		if !ok {
+			return
+		}
+		a := Attachment{Name: name, Description: description, Page: page, id: ref.id}
+		for _, key := range []obj_named{"UF", "F", "Unix", "DOS", "Mac"} {
+			if s, ok := p.resolve_text(spec[key]); ok && s != "" {
+				a.Name = s
+				break
+			}
+		}
+		if s, ok := p.resolve_text(spec["Desc"]); ok && s != "" {
+			a.Description = s
+		}
+		if subtype, ok := stream.metadata["Subtype"].Type.(obj_named); ok {
+			a.MimeType = string(subtype)
+		}
+		result = append(result, a)
+	}
+
+	if catalog := p.catalog(); catalog != nil {
+		names := p.resolve_dict(catalog["Names"])
+		keys, values := p.name_tree(names["EmbeddedFiles"])
+		for i := range values {
+			add(values[i], keys[i], "", 0)
+		}
+	}
+	for n, pg := range p.pages() {
+		for _, o := range p.resolve_array(pg.dict["Annots"]) {
+			dict := p.resolve_dict(o)
+			if dict["Subtype"].Type != obj_named("FileAttachment") {
+				continue
+			}
+			description, _ := p.resolve_text(dict["Contents"])
+			add(dict["FS"], "", description, n+1)
+		}
+	}
+	return result
+}
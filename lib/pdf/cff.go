@@ -0,0 +1,303 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Minimal Compact Font Format reader, used by FontFile3 (Type1C, CIDFontType0C)
+// and OpenType fonts. Only the charset and encoding are read, which is
+// everything needed to get the glyph names back.
+// https://adobe-type-tools.github.io/font-tech-notes/pdfs/5176.CFF.pdf
+
+type cff struct {
+	name     string
+	cid      bool            // CID-keyed font, charset holds CIDs instead of SIDs
+	charset  []uint16        // glyph id to SID or CID
+	encoding map[byte]uint16 // char code to glyph id, nil for CID-keyed fonts
+	strings  []string        // custom strings, the SID of strings[0] is 391
+}
+
+func cff_index(b []byte, pos int) ([][]byte, int, error) {
+	if pos < 0 || pos+2 > len(b) {
+		return nil, pos, errors.New("cff: index out of bounds")
+	}
+	count := int(binary.BigEndian.Uint16(b[pos:]))
+	if count == 0 {
+		return nil, pos + 2, nil
+	}
+	if pos+3 > len(b) {
+		return nil, pos, errors.New("cff: index out of bounds")
+	}
+	off_size := int(b[pos+2])
+	if off_size < 1 || off_size > 4 {
+		return nil, pos, errors.New(fmt.Sprintf("cff: invalid offset size %d", off_size))
+	}
+	offsets := pos + 3
+	data := offsets + (count+1)*off_size - 1 // offsets are 1 based
+	if data >= len(b) {
+		return nil, pos, errors.New("cff: index out of bounds")
+	}
+	read := func(i int) int {
+		var v int
+		for _, c := range b[offsets+i*off_size : offsets+(i+1)*off_size] {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	result := make([][]byte, count)
+	for i := range result {
+		start, end := data+read(i), data+read(i+1)
+		if start > end || end > len(b) {
+			return nil, pos, errors.New("cff: index data out of bounds")
+		}
+		result[i] = b[start:end]
+	}
+	return result, data + read(count), nil
+}
+
+// cff_dict returns the operands of each operator, escaped operators are 1200+op.
+func cff_dict(b []byte) map[int][]float64 {
+	result := map[int][]float64{}
+	var operands []float64
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c <= 21:
+			op := int(c)
+			i++
+			if c == 12 && i < len(b) {
+				op = 1200 + int(b[i])
+				i++
+			}
+			result[op] = operands
+			operands = nil
+		case c == 28 && i+2 < len(b):
+			operands = append(operands, float64(int16(binary.BigEndian.Uint16(b[i+1:]))))
+			i += 3
+		case c == 29 && i+4 < len(b):
+			operands = append(operands, float64(int32(binary.BigEndian.Uint32(b[i+1:]))))
+			i += 5
+		case c == 30:
+			// real numbers are nibbles, we only need integers, skip it.
+			i++
+			for i < len(b) && b[i]&0x0f != 0x0f && b[i]&0xf0 != 0xf0 {
+				i++
+			}
+			i++
+			operands = append(operands, 0)
+		case c >= 32 && c <= 246:
+			operands = append(operands, float64(int(c)-139))
+			i++
+		case c >= 247 && c <= 250 && i+1 < len(b):
+			operands = append(operands, float64((int(c)-247)*256+int(b[i+1])+108))
+			i += 2
+		case c >= 251 && c <= 254 && i+1 < len(b):
+			operands = append(operands, float64(-(int(c)-251)*256-int(b[i+1])-108))
+			i += 2
+		default:
+			i++
+		}
+	}
+	return result
+}
+
+func parse_cff(b []byte) (*cff, error) {
+	if len(b) < 4 || b[0] != 1 {
+		return nil, errors.New("cff: not a CFF font")
+	}
+	names, pos, err := cff_index(b, int(b[2]))
+	if err != nil {
+		return nil, err
+	}
+	top_dicts, pos, err := cff_index(b, pos)
+	if err != nil {
+		return nil, err
+	}
+	strs, _, err := cff_index(b, pos)
+	if err != nil {
+		return nil, err
+	}
+	if len(top_dicts) == 0 {
+		return nil, errors.New("cff: missing top dict")
+	}
+
+	var result cff
+	if len(names) > 0 {
+		result.name = string(names[0])
+	}
+	for _, s := range strs {
+		result.strings = append(result.strings, string(s))
+	}
+	top := cff_dict(top_dicts[0])
+	_, result.cid = top[1230] // ROS
+
+	offset := func(op int) int {
+		if v, ok := top[op]; ok && len(v) > 0 {
+			return int(v[len(v)-1])
+		}
+		return 0
+	}
+	o_charstrings := offset(17)
+	if o_charstrings == 0 {
+		return nil, errors.New("cff: missing CharStrings")
+	}
+	// NOTE(elias): the offsets come from the font, a broken one must not panic.
+	if o_charstrings < 0 || o_charstrings >= len(b) {
+		return nil, errors.New("cff: CharStrings out of bounds")
+	}
+	charstrings, _, err := cff_index(b, o_charstrings)
+	if err != nil {
+		return nil, err
+	}
+	nglyphs := len(charstrings)
+
+	result.charset = make([]uint16, nglyphs)
+	o_charset := offset(15)
+	switch o_charset {
+	case 0: // ISOAdobe
+		for i := range result.charset {
+			result.charset[i] = uint16(i)
+		}
+	case 1, 2: // Expert, ExpertSubset
+		// NOTE(elias): not used by the fonts found so far.
+	default:
+		if o_charset < 0 || o_charset >= len(b) {
+			return nil, errors.New("cff: charset out of bounds")
+		}
+		pos := o_charset + 1
+		gid := 1
+		switch b[o_charset] {
+		case 0:
+			for ; gid < nglyphs && pos+2 <= len(b); gid++ {
+				result.charset[gid] = binary.BigEndian.Uint16(b[pos:])
+				pos += 2
+			}
+		case 1, 2:
+			for gid < nglyphs && pos+3 <= len(b) {
+				first := binary.BigEndian.Uint16(b[pos:])
+				var left int
+				if b[o_charset] == 1 {
+					left = int(b[pos+2])
+					pos += 3
+				} else {
+					if pos+4 > len(b) {
+						break
+					}
+					left = int(binary.BigEndian.Uint16(b[pos+2:]))
+					pos += 4
+				}
+				for i := 0; i <= left && gid < nglyphs; i++ {
+					result.charset[gid] = first + uint16(i)
+					gid++
+				}
+			}
+		}
+	}
+
+	if result.cid {
+		return &result, nil
+	}
+	result.encoding = map[byte]uint16{}
+	o_encoding := offset(16)
+	switch o_encoding {
+	case 0: // Standard
+		for code, name := range standard_encoding {
+			if gid, ok := result.gid_by_name(name); ok {
+				result.encoding[code] = gid
+			}
+		}
+	case 1: // Expert
+	default:
+		if o_encoding < 0 || o_encoding >= len(b) {
+			return nil, errors.New("cff: encoding out of bounds")
+		}
+		format := b[o_encoding]
+		pos := o_encoding + 1
+		switch format & 0x7f {
+		case 0:
+			if pos >= len(b) {
+				break
+			}
+			n := int(b[pos])
+			pos++
+			for i := 0; i < n && pos < len(b); i++ {
+				result.encoding[b[pos]] = uint16(i + 1)
+				pos++
+			}
+		case 1:
+			if pos >= len(b) {
+				break
+			}
+			n := int(b[pos])
+			pos++
+			gid := 1
+			for i := 0; i < n && pos+2 <= len(b); i++ {
+				first, left := int(b[pos]), int(b[pos+1])
+				for c := first; c <= first+left && c < 256; c++ {
+					result.encoding[byte(c)] = uint16(gid)
+					gid++
+				}
+				pos += 2
+			}
+		}
+		if format&0x80 != 0 && pos < len(b) {
+			// supplements: code to SID
+			n := int(b[pos])
+			pos++
+			for i := 0; i < n && pos+3 <= len(b); i++ {
+				sid := binary.BigEndian.Uint16(b[pos+1:])
+				for gid, s := range result.charset {
+					if s == sid {
+						result.encoding[b[pos]] = uint16(gid)
+						break
+					}
+				}
+				pos += 3
+			}
+		}
+	}
+	return &result, nil
+}
+
+// glyph_name returns the name of the glyph, CID-keyed fonts don't have names.
+func (c *cff) glyph_name(gid uint16) string {
+	if c.cid || int(gid) >= len(c.charset) {
+		return ""
+	}
+	sid := int(c.charset[gid])
+	if sid < len(cff_standard_strings) {
+		return cff_standard_strings[sid]
+	}
+	if sid-len(cff_standard_strings) < len(c.strings) {
+		return c.strings[sid-len(cff_standard_strings)]
+	}
+	return ""
+}
+
+func (c *cff) gid_by_name(name string) (uint16, bool) {
+	for gid := range c.charset {
+		if c.glyph_name(uint16(gid)) == name {
+			return uint16(gid), true
+		}
+	}
+	return 0, false
+}
+
+// gid_by_cid returns the glyph for the CID of a CID-keyed font.
+func (c *cff) gid_by_cid(cid uint16) (uint16, bool) {
+	if !c.cid {
+		return cid, int(cid) < len(c.charset)
+	}
+	for gid, _cid := range c.charset {
+		if _cid == cid {
+			return uint16(gid), true
+		}
+	}
+	return 0, false
+}
+
+func (c *cff) unicode(gid uint16) string {
+	return glyph_to_unicode(c.glyph_name(gid))
+}
@@ -0,0 +1,319 @@
+package pdf
+
+import (
+	"log"
+	"strings"
+)
+
+// matrix is a transformation matrix [a b c d e f] as used by `cm` and /Matrix.
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m×n, m applied first.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// to_matrix reads 6 numbers, the operands of `cm` or a /Matrix array.
+func to_matrix(p *pdf, objs []obj) (matrix, bool) {
+	var m matrix
+	if len(objs) != 6 {
+		return identity, false
+	}
+	for i := range objs {
+		v, ok := p.resolve_number(objs[i])
+		if !ok {
+			return identity, false
+		}
+		m[i] = v
+	}
+	return m, true
+}
+
+// text_state has the parameters of the text operators, the text matrices are
+// only valid between BT and ET.
+type text_state struct {
+	tm, tlm    matrix // text matrix and text line matrix
+	char_space float64
+	word_space float64
+	scale      float64 // horizontal scaling, Tz/100
+	leading    float64
+	size       float64
+	rise       float64
+}
+
+// graphics_state is the part of the graphics state saved by `q` and restored by `Q`.
+type graphics_state struct {
+	ctm  matrix
+	font *font
+	text text_state
+}
+
+// number returns the value of a obj_int or obj_real operand.
+func number(o obj) float64 {
+	switch v := o.Type.(type) {
+	case obj_int:
+		return float64(v)
+	case obj_real:
+		return float64(v)
+	}
+	return 0
+}
+
+func new_parse_ctx(doc *pdf, page obj_int, resources obj_dict) *parse_ctx {
+	return &parse_ctx{doc: doc, page: page, resources: resources, ctm: identity, text: text_state{scale: 1}, mcids: map[int]string{}}
+}
+
+// operator updates the state of the content stream and calls handle_operator.
+// The objs produced by the operator, like the text shown or the content of the
+// Form XObject painted by `Do`, are left in `objs`. `cs` is the current color
+// space of the stream.
+func (ctx *parse_ctx) operator(operator string, objs []obj, color_space obj_dict, cs *ColorSpace) ([]obj, error) {
+	if ctx == nil {
+		return handle_operator(objs, operator, color_space, cs)
+	}
+	if ctx.trace == nil {
+		return ctx.operate(operator, objs, color_space, cs)
+	}
+	// the operands are what was pushed after the previous operator
+	start := ctx.trace.start
+	if start > len(objs) {
+		start = len(objs)
+	}
+	operands := append([]obj{}, objs[start:]...)
+	objs, err := ctx.operate(operator, objs, color_space, cs)
+	if start > len(objs) {
+		start = len(objs)
+	}
+	ctx.trace_operator(operator, operands, objs[start:])
+	ctx.trace.start = len(objs)
+	return objs, err
+}
+
+// operate is operator without the trace.
+func (ctx *parse_ctx) operate(operator string, objs []obj, color_space obj_dict, cs *ColorSpace) ([]obj, error) {
+	operands := objs
+	// the last operand, most operators have only one
+	var last obj
+	if len(operands) > 0 {
+		last = operands[len(operands)-1]
+	}
+	var produced []obj
+	switch operator {
+	case "q":
+		ctx.gstack = append(ctx.gstack, graphics_state{ctx.ctm, ctx.font, ctx.text})
+	case "Q":
+		if len(ctx.gstack) > 0 {
+			gs := ctx.gstack[len(ctx.gstack)-1]
+			ctx.gstack = ctx.gstack[:len(ctx.gstack)-1]
+			ctx.ctm, ctx.font, ctx.text = gs.ctm, gs.font, gs.text
+		}
+	case "cm":
+		if len(operands) >= 6 {
+			if m, ok := to_matrix(ctx.doc, operands[len(operands)-6:]); ok {
+				ctx.ctm = m.mul(ctx.ctm)
+			}
+		}
+	case "BT":
+		ctx.text.tm, ctx.text.tlm = identity, identity
+	case "Tc":
+		ctx.text.char_space = number(last)
+	case "Tw":
+		ctx.text.word_space = number(last)
+	case "Tz":
+		ctx.text.scale = number(last) / 100
+	case "TL":
+		ctx.text.leading = number(last)
+	case "Ts":
+		ctx.text.rise = number(last)
+	case "Tf":
+		if len(operands) >= 2 {
+			ctx.text.size = number(last)
+			if name, ok := operands[len(operands)-2].Type.(obj_named); ok {
+				ctx.set_font(name)
+			}
+		}
+	case "Td", "TD":
+		if len(operands) >= 2 {
+			ty := number(last)
+			if operator == "TD" {
+				ctx.text.leading = -ty
+			}
+			ctx.move_text(number(operands[len(operands)-2]), ty)
+		}
+	case "Tm":
+		if len(operands) >= 6 {
+			if m, ok := to_matrix(ctx.doc, operands[len(operands)-6:]); ok {
+				ctx.text.tm, ctx.text.tlm = m, m
+			}
+		}
+	case "T*":
+		ctx.move_text(0, -ctx.text.leading)
+	case "Tj", "TJ", "'", "\"":
+		return ctx.show_text(operator, objs), nil
+	case "Do":
+		if name, ok := last.Type.(obj_named); ok {
+			produced = ctx.do_xobject(name)
+		}
+	case "BMC", "BDC":
+		ctx.begin_marked_content(operator, operands)
+	}
+	objs, err := handle_operator(objs, operator, color_space, cs)
+	if err != nil {
+		return objs, err
+	}
+	if operator == "EMC" {
+		objs = ctx.end_marked_content(objs)
+	}
+	return append(objs, produced...), nil
+}
+
+// move_text starts a new line at the offset (tx, ty) from the current one.
+func (ctx *parse_ctx) move_text(tx, ty float64) {
+	ctx.text.tlm = matrix{1, 0, 0, 1, tx, ty}.mul(ctx.text.tlm)
+	ctx.text.tm = ctx.text.tlm
+}
+
+// position returns where the next glyph will be in the page.
+func (ctx *parse_ctx) position() (float64, float64) {
+	m := ctx.text.tm.mul(ctx.ctm)
+	return ctx.text.rise*m[2] + m[4], ctx.text.rise*m[3] + m[5]
+}
+
+// show_text pops the operands of a text showing operator and pushes the text
+// it shows as obj_text. As in handle_operator, big gaps in TJ split the text.
+func (ctx *parse_ctx) show_text(operator string, objs []obj) []obj {
+	if len(objs) == 0 {
+		log.Printf("ERROR: operator `%s` without operands\n", operator)
+		return objs
+	}
+	var o obj
+	objs, o = Pop(objs)
+	switch operator {
+	case "\"":
+		if len(objs) >= 2 {
+			ctx.text.char_space = number(objs[len(objs)-1])
+			ctx.text.word_space = number(objs[len(objs)-2])
+			objs = objs[:len(objs)-2]
+		}
+		ctx.move_text(0, -ctx.text.leading)
+	case "'":
+		ctx.move_text(0, -ctx.text.leading)
+	}
+	elements := obj_array{o}
+	if operator == "TJ" {
+		elements, _ = o.Type.(obj_array)
+	}
+
+	var text strings.Builder
+	x, y := ctx.position()
+	push := func() {
+		objs = append(objs, obj{obj_text{text.String(), ctx.page, x, y}, o.line, o.col})
+		text.Reset()
+	}
+	for _, e := range elements {
+		switch v := e.Type.(type) {
+		case obj_strl:
+			if text.Len() == 0 {
+				x, y = ctx.position()
+			}
+			text.WriteString(ctx.show(e, []byte(v)))
+		case obj_strh:
+			if text.Len() == 0 {
+				x, y = ctx.position()
+			}
+			text.WriteString(ctx.show(e, []byte(v)))
+		case obj_int, obj_real:
+			space, split := tj_gap(e)
+			if space {
+				text.WriteString(" ")
+			} else if split {
+				push()
+			}
+			tx := -number(e) / 1000 * ctx.text.size * ctx.text.scale
+			ctx.text.tm = matrix{1, 0, 0, 1, tx, 0}.mul(ctx.text.tm)
+		}
+	}
+	push()
+	return objs
+}
+
+// show returns the text of the string `str` and moves the text matrix to the end of it.
+func (ctx *parse_ctx) show(o obj, str []byte) string {
+	var text string
+	if s, ok := ctx.decode(str); ok {
+		text = s
+	} else if _, ok := o.Type.(obj_strh); ok {
+		text = decode_strh(str, ctx.doc.Resources)
+	} else {
+		text = string(str)
+	}
+	codes := ctx.font.codes(str)
+	for _, code := range codes {
+		w := ctx.font.width(code)/1000*ctx.text.size + ctx.text.char_space
+		if code == ' ' && (ctx.font == nil || !ctx.font.two_byte) {
+			w += ctx.text.word_space
+		}
+		ctx.text.tm = matrix{1, 0, 0, 1, w * ctx.text.scale, 0}.mul(ctx.text.tm)
+	}
+	return text
+}
+
+// do_xobject interprets the Form XObject `name` of the resources and returns
+// the objs of its content. Image XObjects have no text and are ignored.
+func (ctx *parse_ctx) do_xobject(name obj_named) []obj {
+	xobjects := ctx.doc.resolve_dict(ctx.resources["XObject"])
+	ref, ok := xobjects[name].Type.(obj_ref)
+	if !ok {
+		return nil
+	}
+	for _, id := range ctx.forms {
+		if id == ref.id {
+			log.Printf("ERROR: Form XObject %s(%d 0 R) paints itself, skipping it\n", name, ref.id)
+			return nil
+		}
+	}
+	ind, ok := ctx.doc.resolve(xobjects[name]).Type.(obj_ind)
+	if !ok || ind.metadata["Subtype"].Type != obj_named("Form") {
+		return nil
+	}
+	data, err := ctx.doc.decode_stream(ind)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	// the form is painted with the graphics state at the `Do`, its /Matrix maps
+	// the form space to the user space. Forms without /Resources use the ones of
+	// the page.
+	form := &parse_ctx{doc: ctx.doc, page: ctx.page, resources: ctx.resources, font: ctx.font, ctm: ctx.ctm, text: ctx.text, mcids: ctx.mcids}
+	if ctx.trace != nil {
+		form.trace = &tracer{emit: ctx.trace.emit, page: ctx.trace.page, stream: ref.id}
+	}
+	if m, ok := to_matrix(ctx.doc, ctx.doc.resolve_array(ind.metadata["Matrix"])); ok {
+		form.ctm = m.mul(ctx.ctm)
+	}
+	if res := ctx.doc.resolve_dict(ind.metadata["Resources"]); res != nil {
+		form.resources = res
+	}
+	form.forms = append(append([]obj_int{}, ctx.forms...), ref.id)
+
+	color_space := ctx.doc.color_space
+	if _, ok := form.resources["ColorSpace"]; ok {
+		color_space = form.resources
+	}
+	_pdf, err := parse(data, color_space, ctx.doc.Resources, form)
+	if err != nil {
+		log.Printf("ERROR: failed to parse Form XObject %s(%d 0 R): %s\n", name, ref.id, err)
+		return nil
+	}
+	return _pdf.objs
+}
@@ -0,0 +1,174 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Interactive form(AcroForm) fields. The values of filled-in forms are in the
+// field dictionaries, not in the content of the pages.
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf#page=432
+
+// Field is a terminal field of the form, Name is the fully qualified name
+// (`parent.child`).
+type Field struct {
+	Name  string
+	Type  string // Tx, Btn, Ch or Sig
+	Value string // checkboxes and radio buttons have the name of their state, `Off` when not selected
+}
+
+const field_pushbutton = 1 << 16 // bit 17 of /Ff
+
+// fields walks the field tree of /AcroForm. /FT, /V, /Ff and /Opt are inherited
+// by the kids.
+func (p *pdf) fields() []Field {
+	catalog := p.catalog()
+	if catalog == nil {
+		return nil
+	}
+	acroform := p.resolve_dict(catalog["AcroForm"])
+	if acroform == nil {
+		return nil
+	}
+	var result []Field
+	visited := map[obj_int]bool{}
+	inheritable := []obj_named{"FT", "V", "Ff", "Opt"}
+	var walk func(o obj, parent string, inherited obj_dict)
+	walk = func(o obj, parent string, inherited obj_dict) {
+		if ref, ok := o.Type.(obj_ref); ok {
+			if visited[ref.id] {
+				return
+			}
+			visited[ref.id] = true
+		}
+		dict := p.resolve_dict(o)
+		if dict == nil {
+			return
+		}
+		name := parent
+		if t, ok := p.resolve_text(dict["T"]); ok {
+			if name != "" {
+				name += "."
+			}
+			name += t
+		}
+		attrs := obj_dict{}
+		for _, key := range inheritable {
+			if v, ok := dict[key]; ok {
+				attrs[key] = v
+			} else if v, ok := inherited[key]; ok {
+				attrs[key] = v
+			}
+		}
+
+		// the kids are either fields or the widget annotations of this field
+		var widgets []obj_dict
+		is_terminal := true
+		for _, kid := range p.resolve_array(dict["Kids"]) {
+			kid_dict := p.resolve_dict(kid)
+			if kid_dict == nil {
+				continue
+			}
+			if _, ok := kid_dict["T"]; ok || kid_dict["Subtype"].Type != obj_named("Widget") {
+				is_terminal = false
+				continue
+			}
+			widgets = append(widgets, kid_dict)
+		}
+		if !is_terminal {
+			for _, kid := range p.resolve_array(dict["Kids"]) {
+				walk(kid, name, attrs)
+			}
+			return
+		}
+		if dict["Subtype"].Type == obj_named("Widget") {
+			widgets = append(widgets, dict)
+		}
+		ft, _ := attrs["FT"].Type.(obj_named)
+		flags, _ := p.resolve_number(attrs["Ff"])
+		if ft == "Btn" && int(flags)&field_pushbutton != 0 {
+			return
+		}
+		result = append(result, Field{name, string(ft), p.field_value(ft, int(flags), attrs, widgets)})
+	}
+	for _, o := range p.resolve_array(acroform["Fields"]) {
+		walk(o, "", nil)
+	}
+	return result
+}
+
+func (p *pdf) field_value(ft obj_named, flags int, attrs obj_dict, widgets []obj_dict) string {
+	v := p.resolve(attrs["V"])
+	opt := p.resolve_array(attrs["Opt"])
+	switch ft {
+	case "Btn":
+		state, ok := v.Type.(obj_named)
+		if !ok {
+			// no value, use the appearance state of the selected widget
+			state = "Off"
+			for _, w := range widgets {
+				if as, ok := w["AS"].Type.(obj_named); ok && as != "Off" {
+					state = as
+				}
+			}
+		}
+		// with /Opt the states are indexes to the export values
+		if i, err := strconv.Atoi(string(state)); err == nil && i >= 0 && i < len(opt) {
+			if s, ok := p.resolve_text(opt[i]); ok {
+				return s
+			}
+		}
+		return string(state)
+	case "Ch":
+		var values []string
+		switch val := v.Type.(type) {
+		case obj_array:
+			for _, o := range val {
+				if s, ok := p.resolve_text(o); ok {
+					values = append(values, s)
+				}
+			}
+		default:
+			if s, ok := p.resolve_text(v); ok {
+				values = append(values, s)
+			}
+		}
+		// /Opt may have pairs of [export value, displayed text]
+		for i := range values {
+			for _, o := range opt {
+				pair, ok := o.Type.(obj_array)
+				if !ok || len(pair) != 2 {
+					continue
+				}
+				export, _ := p.resolve_text(pair[0])
+				text, _ := p.resolve_text(pair[1])
+				if export == values[i] {
+					values[i] = text
+					break
+				}
+			}
+		}
+		return strings.Join(values, ", ")
+	case "Sig":
+		return ""
+	}
+	if ind, ok := v.Type.(obj_ind); ok {
+		// long text values can be a stream
+		data, err := p.decode_stream(ind)
+		if err == nil {
+			return text_string(string(data))
+		}
+		return ""
+	}
+	s, _ := p.resolve_text(v)
+	return s
+}
+
+// FieldValues returns the value of each field by its fully qualified name.
+func (p pdf) FieldValues() map[string]string {
+	result := make(map[string]string, len(p.Fields))
+	for _, f := range p.Fields {
+		result[f.Name] = f.Value
+	}
+	return result
+}
@@ -0,0 +1,209 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// decode_stream returns the content of the stream of `ind` after applying its
+// /Filter list.
+func (p *pdf) decode_stream(ind obj_ind) ([]byte, error) {
+	if len(ind.stream.decoded_content) > 0 || len(ind.stream.encoded_content) == 0 {
+		return ind.stream.decoded_content, nil
+	}
+	var filters []obj_named
+	switch v := p.resolve(ind.metadata["Filter"]).Type.(type) {
+	case obj_named:
+		filters = append(filters, v)
+	case obj_array:
+		for _, o := range v {
+			if f, ok := p.resolve(o).Type.(obj_named); ok {
+				filters = append(filters, f)
+			}
+		}
+	}
+	// /DecodeParms is a dict for a single filter or an array with one entry by filter
+	parms := make([]obj_dict, len(filters))
+	switch v := p.resolve(ind.metadata["DecodeParms"]).Type.(type) {
+	case obj_dict:
+		if len(parms) > 0 {
+			parms[0] = v
+		}
+	case obj_array:
+		for i := range v {
+			if i < len(parms) {
+				parms[i] = p.resolve_dict(v[i])
+			}
+		}
+	}
+	data := ind.stream.encoded_content
+	for i, f := range filters {
+		var err error
+		data, err = apply_filter(f, data)
+		if err == nil && (f == "FlateDecode" || f == "Fl") {
+			data, err = p.unpredict(data, parms[i])
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("failled to decode stream of obj %d:%d %v", ind.id, ind.mod_id, err))
+		}
+	}
+	return data, nil
+}
+
+// unpredict reverts the PNG predictors(/Predictor 10 to 15) of a Flate stream,
+// mostly used by cross-reference streams. Each row starts with the predictor used
+// for it.
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf#page=36
+func (p *pdf) unpredict(data []byte, parms obj_dict) ([]byte, error) {
+	predictor, _ := p.resolve_number(parms["Predictor"])
+	if predictor < 10 {
+		if predictor > 1 {
+			return data, errors.New(fmt.Sprintf("predictor %v not implemented", predictor))
+		}
+		return data, nil
+	}
+	param := func(key obj_named, value float64) int {
+		if v, ok := p.resolve_number(parms[key]); ok {
+			return int(v)
+		}
+		return int(value)
+	}
+	bpp := (param("Colors", 1)*param("BitsPerComponent", 8) + 7) / 8
+	row := (param("Columns", 1)*param("Colors", 1)*param("BitsPerComponent", 8) + 7) / 8
+	if row <= 0 || bpp <= 0 {
+		return data, errors.New("invalid /DecodeParms")
+	}
+	var result []byte
+	prev := make([]byte, row)
+	for i := 0; i+1 < len(data); i += row + 1 {
+		end := i + 1 + row
+		if end > len(data) {
+			end = len(data)
+		}
+		cur := make([]byte, row)
+		copy(cur, data[i+1:end])
+		for j := range cur {
+			var left, up, up_left byte
+			if j >= bpp {
+				left = cur[j-bpp]
+				up_left = prev[j-bpp]
+			}
+			up = prev[j]
+			switch data[i] {
+			case 1: // Sub
+				cur[j] += left
+			case 2: // Up
+				cur[j] += up
+			case 3: // Average
+				cur[j] += byte((int(left) + int(up)) / 2)
+			case 4: // Paeth
+				cur[j] += paeth(left, up, up_left)
+			}
+		}
+		result = append(result, cur[:end-i-1]...)
+		prev = cur
+	}
+	return result, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	abs := func(v int) int {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func apply_filter(filter obj_named, data []byte) ([]byte, error) {
+	switch filter {
+	case "FlateDecode", "Fl":
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		result, err := io.ReadAll(r)
+		if err != nil && len(result) == 0 {
+			return nil, err
+		}
+		// NOTE(elias): a lot of PDFs have a broken checksum at the end of the stream,
+		// keep what was inflated.
+		return result, nil
+	case "ASCIIHexDecode", "AHx":
+		data = bytes.Map(func(r rune) rune {
+			switch r {
+			case ' ', '\t', '\r', '\n', '\f', 0:
+				return -1
+			}
+			return r
+		}, data)
+		if i := bytes.IndexByte(data, '>'); i != -1 {
+			data = data[:i]
+		}
+		if len(data)%2 != 0 {
+			data = append(data, '0')
+		}
+		result := make([]byte, len(data)/2)
+		_, err := hex.Decode(result, data)
+		return result, err
+	case "ASCII85Decode", "A85":
+		return ascii85_decode(data)
+	}
+	return nil, errors.New(fmt.Sprintf("filter `%s` not implemented", filter))
+}
+
+func ascii85_decode(data []byte) ([]byte, error) {
+	var result []byte
+	var group [5]byte
+	n := 0
+loop:
+	for _, c := range data {
+		switch {
+		case c == '~':
+			break loop
+		case c == 'z' && n == 0:
+			result = append(result, 0, 0, 0, 0)
+			continue
+		case c < '!' || c > 'u':
+			continue
+		}
+		group[n] = c - '!'
+		n++
+		if n == 5 {
+			var v uint32
+			for _, g := range group {
+				v = v*85 + uint32(g)
+			}
+			result = append(result, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+			n = 0
+		}
+	}
+	if n == 1 {
+		return result, errors.New("ASCII85 stream ends with a single character")
+	}
+	if n > 0 {
+		for i := n; i < 5; i++ {
+			group[i] = 84
+		}
+		var v uint32
+		for _, g := range group {
+			v = v*85 + uint32(g)
+		}
+		b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		result = append(result, b[:n-1]...)
+	}
+	return result, nil
+}
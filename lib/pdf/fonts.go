@@ -0,0 +1,433 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+type font struct {
+	base_font     obj_named
+	subtype       obj_named
+	two_byte      bool                     // composite fonts(Type0) use 2 bytes codes
+	to_unicode    []obj_resources          // the /ToUnicode CMap
+	glyphs        map[obj_codechar]string  // recovered from /Encoding or the embedded font program
+	widths        map[obj_codechar]float64 // in 1/1000 of the text space
+	default_width float64
+}
+
+// codechar_string converts a CMap destination, UTF-16BE packed in an integer, to text.
+func codechar_string(c obj_codechar) string {
+	var units []uint16
+	for ; c > 0; c >>= 16 {
+		units = append([]uint16{uint16(c)}, units...)
+	}
+	if len(units) == 0 {
+		units = []uint16{0}
+	}
+	return string(utf16.Decode(units))
+}
+
+// to_unicode returns the text of `code` using the bfchar and bfrange of the CMap.
+func (res obj_resources) to_unicode(code obj_codechar) (string, bool) {
+	if c, ok := res.CodeSpace.bfchars[code]; ok {
+		return codechar_string(c), true
+	}
+	for _, r := range res.CodeSpace.bfranges {
+		if r.start <= code && code <= r.end {
+			if len(r.dest_array) > 0 {
+				if int(code-r.start) < len(r.dest_array) {
+					return codechar_string(r.dest_array[code-r.start]), true
+				}
+				return "", false
+			}
+			return codechar_string(r.dest_codechar + code - r.start), true
+		}
+	}
+	return "", false
+}
+
+// load_font reads the font dictionary `o` and everything needed to turn its codes
+// back to text. Fonts are cached by object id.
+func (p *pdf) load_font(o obj) *font {
+	ref, is_ref := o.Type.(obj_ref)
+	if is_ref {
+		if f, ok := p.fonts[ref.id]; ok {
+			return f
+		}
+	}
+	dict := p.resolve_dict(o)
+	if dict == nil {
+		return nil
+	}
+	f := &font{glyphs: map[obj_codechar]string{}, widths: map[obj_codechar]float64{}}
+	f.subtype, _ = dict["Subtype"].Type.(obj_named)
+	f.base_font, _ = dict["BaseFont"].Type.(obj_named)
+
+	if stream, ok := p.resolve(dict["ToUnicode"]).Type.(obj_ind); ok {
+		data, err := p.decode_stream(stream)
+		if err == nil {
+			cmap, err := Parse(data, nil, nil)
+			if err == nil {
+				f.to_unicode = cmap.Resources
+			}
+		}
+	}
+
+	descendant := dict
+	if f.subtype == "Type0" {
+		f.two_byte = true
+		fonts := p.resolve_array(dict["DescendantFonts"])
+		if len(fonts) > 0 {
+			if d, ok := fonts[0].Type.(obj_dict); ok {
+				descendant = d
+			}
+		}
+		f.load_cid_widths(p, descendant)
+	} else {
+		f.load_simple_widths(p, dict)
+	}
+	if len(f.to_unicode) == 0 {
+		// without a ToUnicode the codes only make sense through the font itself
+		f.load_program(p, descendant)
+		if !f.two_byte {
+			f.load_differences(p, dict)
+		}
+	}
+
+	if is_ref {
+		if p.fonts == nil {
+			p.fonts = map[obj_int]*font{}
+		}
+		p.fonts[ref.id] = f
+	}
+	return f
+}
+
+func (f *font) load_simple_widths(p *pdf, dict obj_dict) {
+	first, _ := p.resolve_number(dict["FirstChar"])
+	for i, o := range p.resolve_array(dict["Widths"]) {
+		if w, ok := p.resolve_number(o); ok {
+			f.widths[obj_codechar(int(first)+i)] = w
+		}
+	}
+	desc := p.resolve_dict(dict["FontDescriptor"])
+	f.default_width, _ = p.resolve_number(desc["MissingWidth"])
+}
+
+// max_cid is the last CID, the ranges of /W are clamped to it.
+const max_cid = 0xffff
+
+// load_cid_widths reads the /W array: `c [w1 w2 …]` or `c_first c_last w`.
+func (f *font) load_cid_widths(p *pdf, dict obj_dict) {
+	f.default_width = 1000
+	if dw, ok := p.resolve_number(dict["DW"]); ok {
+		f.default_width = dw
+	}
+	w := p.resolve_array(dict["W"])
+	for i := 0; i+1 < len(w); {
+		first, ok := p.resolve_number(w[i])
+		if !ok {
+			break
+		}
+		if array, ok := w[i+1].Type.(obj_array); ok {
+			for j, o := range array {
+				if c := int(first) + j; c < 0 || c > max_cid {
+					continue
+				}
+				if width, ok := p.resolve_number(o); ok {
+					f.widths[obj_codechar(int(first)+j)] = width
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			break
+		}
+		last, _ := p.resolve_number(w[i+1])
+		width, _ := p.resolve_number(w[i+2])
+		// NOTE(elias): `0 2000000000 500` would fill the memory, the CIDs are 2 bytes.
+		if first < 0 {
+			first = 0
+		}
+		if last > max_cid {
+			last = max_cid
+		}
+		for c := int(first); c <= int(last); c++ {
+			f.widths[obj_codechar(c)] = width
+		}
+		i += 3
+	}
+}
+
+// load_differences applies the /Differences of the /Encoding dictionary:
+// [code /name1 /name2 … code /name …]
+func (f *font) load_differences(p *pdf, dict obj_dict) {
+	encoding := p.resolve_dict(dict["Encoding"])
+	var code int
+	for _, o := range p.resolve_array(encoding["Differences"]) {
+		switch v := o.Type.(type) {
+		case obj_int:
+			code = int(v)
+		case obj_named:
+			if s := glyph_to_unicode(string(v)); s != "" {
+				f.glyphs[obj_codechar(code)] = s
+			}
+			code++
+		}
+	}
+}
+
+// load_program reads the embedded font program of the font descriptor, used
+// when the font doesn't have a ToUnicode CMap.
+func (f *font) load_program(p *pdf, dict obj_dict) {
+	desc := p.resolve_dict(dict["FontDescriptor"])
+	if desc == nil {
+		return
+	}
+	for _, key := range []obj_named{"FontFile2", "FontFile3", "FontFile"} {
+		stream, ok := p.resolve(desc[key]).Type.(obj_ind)
+		if !ok {
+			continue
+		}
+		data, err := p.decode_stream(stream)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		subtype, _ := stream.metadata["Subtype"].Type.(obj_named)
+		switch {
+		case key == "FontFile2" || subtype == "OpenType":
+			sf, err := parse_sfnt(data)
+			if err != nil {
+				continue
+			}
+			if sf.cff != nil && len(sf.cmaps) == 0 {
+				f.load_cff(sf.cff)
+			} else {
+				f.load_sfnt(p, sf, dict)
+			}
+		case key == "FontFile3":
+			c, err := parse_cff(data)
+			if err != nil {
+				continue
+			}
+			f.load_cff(c)
+		default:
+			f.load_type1(data)
+		}
+		return
+	}
+}
+
+func (f *font) load_sfnt(p *pdf, sf *sfnt, dict obj_dict) {
+	set_width := func(code obj_codechar, gid uint16) {
+		if _, ok := f.widths[code]; ok {
+			return
+		}
+		if w, ok := sf.width(gid); ok {
+			f.widths[code] = w
+		}
+	}
+	if f.two_byte {
+		// CIDFontType2: CID to glyph id is /CIDToGIDMap, /Identity or a stream
+		// with 2 bytes per CID.
+		n := sf.num_glyphs
+		if n == 0 {
+			n = len(sf.glyph_names)
+		}
+		if stream, ok := p.resolve(dict["CIDToGIDMap"]).Type.(obj_ind); ok {
+			data, _ := p.decode_stream(stream)
+			for cid := 0; cid*2+1 < len(data); cid++ {
+				gid := binary.BigEndian.Uint16(data[cid*2:])
+				if gid == 0 {
+					continue
+				}
+				if s := sf.unicode(gid); s != "" {
+					f.glyphs[obj_codechar(cid)] = s
+				}
+				set_width(obj_codechar(cid), gid)
+			}
+			return
+		}
+		for gid := 1; gid < n; gid++ {
+			if s := sf.unicode(uint16(gid)); s != "" {
+				f.glyphs[obj_codechar(gid)] = s
+			}
+			set_width(obj_codechar(gid), uint16(gid))
+		}
+		return
+	}
+	for code := 0; code < 256; code++ {
+		var gid uint16
+		var ok bool
+		// symbolic fonts map the codes to 0xF0XX
+		for _, c := range []uint32{uint32(code), 0xf000 + uint32(code), 0xf100 + uint32(code), 0xf200 + uint32(code)} {
+			if gid, ok = sf.lookup_cmap(3, 0, c); ok {
+				break
+			}
+		}
+		if !ok {
+			gid, ok = sf.lookup_cmap(1, 0, uint32(code))
+		}
+		if !ok {
+			gid, ok = sf.lookup_cmap(3, 1, uint32(code))
+		}
+		if !ok || gid == 0 {
+			continue
+		}
+		if s := sf.unicode(gid); s != "" {
+			f.glyphs[obj_codechar(code)] = s
+		}
+		set_width(obj_codechar(code), gid)
+	}
+}
+
+func (f *font) load_cff(c *cff) {
+	if f.two_byte {
+		for gid := range c.charset {
+			cid := uint16(gid)
+			if c.cid {
+				cid = c.charset[gid]
+			}
+			if s := c.unicode(uint16(gid)); s != "" {
+				f.glyphs[obj_codechar(cid)] = s
+			}
+		}
+		return
+	}
+	for code, gid := range c.encoding {
+		if s := c.unicode(gid); s != "" {
+			f.glyphs[obj_codechar(code)] = s
+		}
+	}
+}
+
+// load_type1 reads the encoding from the clear text part of a Type1 font:
+// `/Encoding StandardEncoding def` or `dup 65 /A put` lines.
+func (f *font) load_type1(data []byte) {
+	if i := bytes.Index(data, []byte("eexec")); i != -1 {
+		data = data[:i]
+	}
+	i := bytes.Index(data, []byte("/Encoding"))
+	if i == -1 {
+		return
+	}
+	data = data[i:]
+	if bytes.HasPrefix(bytes.TrimSpace(data[len("/Encoding"):]), []byte("StandardEncoding")) {
+		for code, name := range standard_encoding {
+			f.glyphs[obj_codechar(code)] = glyph_to_unicode(name)
+		}
+		return
+	}
+	fields := strings.Fields(string(data))
+	for i := 0; i+3 < len(fields); i++ {
+		if fields[i] == "readonly" || fields[i] == "def" {
+			break
+		}
+		if fields[i] != "dup" || fields[i+3] != "put" {
+			continue
+		}
+		code, err := strconv.Atoi(fields[i+1])
+		if err != nil || !strings.HasPrefix(fields[i+2], "/") {
+			continue
+		}
+		if s := glyph_to_unicode(fields[i+2][1:]); s != "" {
+			f.glyphs[obj_codechar(code)] = s
+		}
+		i += 3
+	}
+}
+
+// codes splits the string in character codes.
+func (f *font) codes(str []byte) []obj_codechar {
+	var result []obj_codechar
+	if f != nil && f.two_byte {
+		for i := 0; i+1 < len(str); i += 2 {
+			result = append(result, obj_codechar(str[i])<<8|obj_codechar(str[i+1]))
+		}
+		return result
+	}
+	for _, c := range str {
+		result = append(result, obj_codechar(c))
+	}
+	return result
+}
+
+// decode converts the codes of `str` to text. It returns false when the font
+// doesn't have a way to map its codes.
+func (f *font) decode(str []byte) (string, bool) {
+	if f == nil || (len(f.to_unicode) == 0 && len(f.glyphs) == 0) {
+		return "", false
+	}
+	var result strings.Builder
+	for _, code := range f.codes(str) {
+		result.WriteString(f.unicode(code))
+	}
+	return result.String(), true
+}
+
+func (f *font) unicode(code obj_codechar) string {
+	for _, res := range f.to_unicode {
+		if s, ok := res.to_unicode(code); ok {
+			return s
+		}
+	}
+	if s, ok := f.glyphs[code]; ok {
+		return s
+	}
+	return string(rune(code))
+}
+
+// width returns the width of the glyph in 1/1000 of the text space.
+func (f *font) width(code obj_codechar) float64 {
+	if f == nil {
+		return 0
+	}
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	return f.default_width
+}
+
+// set_font selects the font `name` of the resources, as in `/F1 12 Tf`.
+func (ctx *parse_ctx) set_font(name obj_named) {
+	ctx.font = nil
+	fonts := ctx.doc.resolve_dict(ctx.resources["Font"])
+	if o, ok := fonts[name]; ok {
+		ctx.font = ctx.doc.load_font(o)
+	}
+}
+
+// decode converts the string using the current font.
+func (ctx *parse_ctx) decode(str []byte) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	return ctx.font.decode(str)
+}
+
+// hex_decode converts the content of a hexadecimal string, <48656c6c6f>, to bytes.
+func hex_decode(str string) []byte {
+	str = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', '\f', 0:
+			return -1
+		}
+		return r
+	}, str)
+	if len(str)%2 != 0 {
+		str += "0"
+	}
+	result := make([]byte, 0, len(str)/2)
+	for i := 0; i+1 < len(str); i += 2 {
+		c, err := strconv.ParseUint(str[i:i+2], 16, 8)
+		if err != nil {
+			continue
+		}
+		result = append(result, byte(c))
+	}
+	return result
+}
@@ -0,0 +1,259 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// build_sfnt writes a TrueType font with the given tables.
+func build_sfnt(tables map[string][]byte) []byte {
+	var tags []string
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	b := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(b, 0x00010000)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(tags)))
+	for i, tag := range tags {
+		rec := b[12+i*16:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(b)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(tables[tag])))
+		b = append(b, tables[tag]...)
+	}
+	return b
+}
+
+func u16(v ...int) []byte {
+	b := make([]byte, len(v)*2)
+	for i := range v {
+		binary.BigEndian.PutUint16(b[i*2:], uint16(v[i]))
+	}
+	return b
+}
+
+// test_font has the glyphs .notdef, H and i. `H` is only found by its name in the
+// post table, `i` only by the unicode cmap.
+func test_font() []byte {
+	cmap := append(u16(0, 1, 3, 1, 0, 12), // header, one (3,1) subtable at offset 12
+		u16(4, 32, 0, 4, 0, 0, 0, // format 4, length, language, segCountX2
+			0x69, 0xffff, // endCode
+			0,            // reservedPad
+			0x69, 0xffff, // startCode
+			2-0x69, 1, // idDelta
+			0, 0)...) // idRangeOffset
+	post := make([]byte, 32)
+	binary.BigEndian.PutUint32(post, 0x00020000)
+	post = append(post, u16(3, 0, 258, 0)...)
+	post = append(post, 1, 'H')
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint16(head[18:], 2048)
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(hhea[34:], 2)
+	maxp := append([]byte{0, 0, 0x50, 0}, u16(3)...)
+	hmtx := u16(1024, 0, 1478, 0)
+	return build_sfnt(map[string][]byte{"cmap": cmap, "post": post, "head": head, "hhea": hhea, "maxp": maxp, "hmtx": hmtx})
+}
+
+func TestSfnt(t *testing.T) {
+	log.SetPrefix("TestSfnt: ")
+	sf, err := parse_sfnt(test_font())
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	for gid, expected := range []string{"", "H", "i"} {
+		if s := sf.unicode(uint16(gid)); s != expected {
+			log.Printf("glyph %d: expected `%s`, found `%s`\n", gid, expected, s)
+			t.Fail()
+		}
+	}
+	// the last advance is repeated for the glyphs after numberOfHMetrics
+	for gid, expected := range []float64{500, 721.6796875, 721.6796875} {
+		if w, _ := sf.width(uint16(gid)); w != expected {
+			log.Printf("glyph %d: expected width %v, found %v\n", gid, expected, w)
+			t.Fail()
+		}
+	}
+}
+
+func TestCFF(t *testing.T) {
+	log.SetPrefix("TestCFF: ")
+	file, err := ioutil.ReadFile("../../sample/pdf_example.pdf")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	pdf, err := Parse(file, nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	ind, err := pdf.lookup(15) // FontFile3 of LMRoman10-Regular
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	data, err := pdf.decode_stream(ind)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	c, err := parse_cff(data)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if !c.cid || c.name != "LMRoman10-Regular" || len(c.charset) < 2 {
+		log.Printf("unexpected font `%s` cid: %v glyphs: %d\n", c.name, c.cid, len(c.charset))
+		t.Fail()
+	}
+}
+
+// build_cff writes a CFF font with one glyph whose top dict has the operators
+// of `dict`, -1 is the offset of the CharStrings INDEX at the end of the font.
+func build_cff(dict map[int]int) []byte {
+	var ops []int
+	for op := range dict {
+		ops = append(ops, op)
+	}
+	sort.Ints(ops)
+	var top []byte
+	for _, op := range ops {
+		top = append(top, 29, 0, 0, 0, 0, byte(op))
+	}
+	b := []byte{1, 0, 4, 1, 0, 1, 1, 1, 2, 'A'} // header, name INDEX
+	b = append(b, 0, 1, 1, 1, byte(1+len(top)))
+	top_start := len(b)
+	b = append(b, top...)
+	b = append(b, 0, 0) // string INDEX
+	charstrings := len(b)
+	b = append(b, 0, 1, 1, 1, 2, 14) // CharStrings INDEX, an endchar
+	for i, op := range ops {
+		v := dict[op]
+		if v == -1 {
+			v = charstrings
+		}
+		binary.BigEndian.PutUint32(b[top_start+i*6+1:], uint32(int32(v)))
+	}
+	return b
+}
+
+func TestMalformedCFF(t *testing.T) {
+	log.SetPrefix("TestMalformedCFF: ")
+	if _, err := parse_cff(build_cff(map[int]int{17: -1})); err != nil {
+		log.Printf("the valid font failed: %s\n", err)
+		t.Fail()
+	}
+	for _, dict := range []map[int]int{
+		{17: -100},
+		{17: 5000},
+		{17: -1, 15: -100},
+		{17: -1, 15: 5000},
+		{17: -1, 16: -100},
+		{17: -1, 16: 5000},
+	} {
+		if _, err := parse_cff(build_cff(dict)); err == nil {
+			log.Printf("%v: expected an error\n", dict)
+			t.Fail()
+		}
+	}
+}
+
+func TestCIDWidths(t *testing.T) {
+	log.SetPrefix("TestCIDWidths: ")
+	number := func(n int) obj {
+		return obj{obj_int(n), 0, 0}
+	}
+	f := &font{widths: map[obj_codechar]float64{}}
+	// a huge range and one before the first CID, only the valid CIDs are kept
+	w := obj_array{number(0), number(2000000000), number(500), number(-10), number(-5), number(300)}
+	f.load_cid_widths(&pdf{}, obj_dict{"W": obj{w, 0, 0}})
+	if len(f.widths) != max_cid+1 || f.width(max_cid) != 500 {
+		log.Printf("expected %d widths of 500, found %d\n", max_cid+1, len(f.widths))
+		t.Fail()
+	}
+}
+
+func TestGlyphToUnicode(t *testing.T) {
+	log.SetPrefix("TestGlyphToUnicode: ")
+	for name, expected := range map[string]string{
+		"A":           "A",
+		"eacute":      "é",
+		"ccedilla":    "ç",
+		"f_f":         "ff",
+		"a.sc":        "a",
+		"uni00E9":     "é",
+		"uni00660069": "fi",
+		"u1F600":      "😀",
+		"zero":        "0",
+		"glyph123":    "",
+	} {
+		if s := glyph_to_unicode(name); s != expected {
+			log.Printf("`%s`: expected `%s`, found `%s`\n", name, expected, s)
+			t.Fail()
+		}
+	}
+}
+
+// A Type0 font without ToUnicode, the text can only be recovered from the
+// embedded TrueType font.
+func TestEmbeddedFont(t *testing.T) {
+	log.SetPrefix("TestEmbeddedFont: ")
+	font := hex.EncodeToString(test_font())
+	content := "BT /F1 12 Tf 72 700 Td <00010002> Tj ET"
+	str := fmt.Sprintf(`%%PDF-1.4
+1 0 obj
+<</Type/Catalog/Pages 2 0 R>>
+endobj
+2 0 obj
+<</Type/Pages/Kids[3 0 R]/Count 1>>
+endobj
+3 0 obj
+<</Type/Page/Parent 2 0 R/Resources<</Font<</F1 5 0 R>>>>/Contents 4 0 R>>
+endobj
+4 0 obj
+<</Length %d>>
+stream
+%s
+endstream
+endobj
+5 0 obj
+<</Type/Font/Subtype/Type0/BaseFont/Test/Encoding/Identity-H/DescendantFonts[6 0 R]>>
+endobj
+6 0 obj
+<</Type/Font/Subtype/CIDFontType2/BaseFont/Test/CIDToGIDMap/Identity/FontDescriptor 7 0 R>>
+endobj
+7 0 obj
+<</Type/FontDescriptor/FontName/Test/FontFile2 8 0 R>>
+endobj
+8 0 obj
+<</Length %d/Length1 %d/Filter/ASCIIHexDecode>>
+stream
+%s>
+endstream
+endobj
+trailer
+<</Root 1 0 R>>
+%%%%EOF`, len(content), content, len(font)+1, len(font)/2, font)
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if strings.Join(pdf.Text, "") != "Hi" {
+		log.Printf("expected `Hi`, found %q\n", pdf.Text)
+		t.Fail()
+	}
+	f := pdf.fonts[5]
+	if f == nil || f.width(1) != 721.6796875 {
+		log.Printf("expected the width from hmtx, found %v\n", f)
+		t.Fail()
+	}
+}
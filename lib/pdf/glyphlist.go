@@ -0,0 +1,578 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// glyph_to_unicode returns the text of a glyph name, following the Adobe Glyph
+// List naming conventions (`uniXXXX`, `uXXXX`, ligatures `f_f` and suffixes `a.sc`).
+// https://github.com/adobe-type-tools/agl-specification
+func glyph_to_unicode(name string) string {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if strings.Contains(name, "_") {
+		var result string
+		for _, part := range strings.Split(name, "_") {
+			result += glyph_to_unicode(part)
+		}
+		return result
+	}
+	if s, ok := glyph_names[name]; ok {
+		return s
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 && (len(name)-3)%4 == 0 {
+		var result string
+		for i := 3; i < len(name); i += 4 {
+			c, err := strconv.ParseUint(name[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			result += string(rune(c))
+		}
+		return result
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		c, err := strconv.ParseUint(name[1:], 16, 32)
+		if err == nil && c <= 0x10ffff {
+			return string(rune(c))
+		}
+	}
+	return ""
+}
+
+// glyph_names is the subset of the Adobe Glyph List used by latin text.
+var glyph_names = map[string]string{
+	"A":                "A",
+	"AE":               "\u00c6",
+	"Aacute":           "\u00c1",
+	"Acircumflex":      "\u00c2",
+	"Adieresis":        "\u00c4",
+	"Agrave":           "\u00c0",
+	"Aring":            "\u00c5",
+	"Atilde":           "\u00c3",
+	"B":                "B",
+	"C":                "C",
+	"Cacute":           "\u0106",
+	"Ccaron":           "\u010c",
+	"Ccedilla":         "\u00c7",
+	"D":                "D",
+	"Delta":            "\u2206",
+	"E":                "E",
+	"Eacute":           "\u00c9",
+	"Ecircumflex":      "\u00ca",
+	"Edieresis":        "\u00cb",
+	"Egrave":           "\u00c8",
+	"Eth":              "\u00d0",
+	"Euro":             "\u20ac",
+	"F":                "F",
+	"G":                "G",
+	"Gbreve":           "\u011e",
+	"H":                "H",
+	"I":                "I",
+	"Iacute":           "\u00cd",
+	"Icircumflex":      "\u00ce",
+	"Idieresis":        "\u00cf",
+	"Idotaccent":       "\u0130",
+	"Igrave":           "\u00cc",
+	"J":                "J",
+	"K":                "K",
+	"L":                "L",
+	"Lslash":           "\u0141",
+	"M":                "M",
+	"N":                "N",
+	"Ntilde":           "\u00d1",
+	"O":                "O",
+	"OE":               "\u0152",
+	"Oacute":           "\u00d3",
+	"Ocircumflex":      "\u00d4",
+	"Odieresis":        "\u00d6",
+	"Ograve":           "\u00d2",
+	"Omega":            "\u03a9",
+	"Oslash":           "\u00d8",
+	"Otilde":           "\u00d5",
+	"P":                "P",
+	"Q":                "Q",
+	"R":                "R",
+	"S":                "S",
+	"Scaron":           "\u0160",
+	"Scedilla":         "\u015e",
+	"T":                "T",
+	"Thorn":            "\u00de",
+	"U":                "U",
+	"Uacute":           "\u00da",
+	"Ucircumflex":      "\u00db",
+	"Udieresis":        "\u00dc",
+	"Ugrave":           "\u00d9",
+	"V":                "V",
+	"W":                "W",
+	"X":                "X",
+	"Y":                "Y",
+	"Yacute":           "\u00dd",
+	"Ydieresis":        "\u0178",
+	"Z":                "Z",
+	"Zcaron":           "\u017d",
+	"a":                "a",
+	"aacute":           "\u00e1",
+	"acircumflex":      "\u00e2",
+	"acute":            "\u00b4",
+	"adieresis":        "\u00e4",
+	"ae":               "\u00e6",
+	"agrave":           "\u00e0",
+	"ampersand":        "&",
+	"approxequal":      "\u2248",
+	"aring":            "\u00e5",
+	"asciicircum":      "^",
+	"asciitilde":       "~",
+	"asterisk":         "*",
+	"at":               "@",
+	"atilde":           "\u00e3",
+	"b":                "b",
+	"backslash":        "\\",
+	"bar":              "|",
+	"braceleft":        "{",
+	"braceright":       "}",
+	"bracketleft":      "[",
+	"bracketright":     "]",
+	"breve":            "\u02d8",
+	"brokenbar":        "\u00a6",
+	"bullet":           "\u2022",
+	"c":                "c",
+	"cacute":           "\u0107",
+	"caron":            "\u02c7",
+	"ccaron":           "\u010d",
+	"ccedilla":         "\u00e7",
+	"cedilla":          "\u00b8",
+	"cent":             "\u00a2",
+	"circumflex":       "\u02c6",
+	"colon":            ":",
+	"comma":            ",",
+	"copyright":        "\u00a9",
+	"currency":         "\u00a4",
+	"d":                "d",
+	"dagger":           "\u2020",
+	"daggerdbl":        "\u2021",
+	"dcroat":           "\u0111",
+	"degree":           "\u00b0",
+	"dieresis":         "\u00a8",
+	"divide":           "\u00f7",
+	"dollar":           "$",
+	"dotaccent":        "\u02d9",
+	"dotlessi":         "\u0131",
+	"e":                "e",
+	"eacute":           "\u00e9",
+	"ecircumflex":      "\u00ea",
+	"edieresis":        "\u00eb",
+	"egrave":           "\u00e8",
+	"eight":            "8",
+	"ellipsis":         "\u2026",
+	"emdash":           "\u2014",
+	"endash":           "\u2013",
+	"equal":            "=",
+	"eth":              "\u00f0",
+	"exclam":           "!",
+	"exclamdown":       "\u00a1",
+	"f":                "f",
+	"ff":               "\ufb00",
+	"ffi":              "\ufb03",
+	"ffl":              "\ufb04",
+	"fi":               "\ufb01",
+	"five":             "5",
+	"fl":               "\ufb02",
+	"florin":           "\u0192",
+	"four":             "4",
+	"fraction":         "\u2044",
+	"franc":            "\u20a3",
+	"g":                "g",
+	"gbreve":           "\u011f",
+	"germandbls":       "\u00df",
+	"grave":            "`",
+	"greater":          ">",
+	"greaterequal":     "\u2265",
+	"guillemotleft":    "\u00ab",
+	"guillemotright":   "\u00bb",
+	"guilsinglleft":    "\u2039",
+	"guilsinglright":   "\u203a",
+	"h":                "h",
+	"hungarumlaut":     "\u02dd",
+	"hyphen":           "-",
+	"i":                "i",
+	"iacute":           "\u00ed",
+	"icircumflex":      "\u00ee",
+	"idieresis":        "\u00ef",
+	"igrave":           "\u00ec",
+	"infinity":         "\u221e",
+	"integral":         "\u222b",
+	"j":                "j",
+	"k":                "k",
+	"l":                "l",
+	"less":             "<",
+	"lessequal":        "\u2264",
+	"logicalnot":       "\u00ac",
+	"lozenge":          "\u25ca",
+	"lslash":           "\u0142",
+	"m":                "m",
+	"macron":           "\u00af",
+	"minus":            "\u2212",
+	"mu":               "\u00b5",
+	"multiply":         "\u00d7",
+	"n":                "n",
+	"nbspace":          "\u00a0",
+	"nine":             "9",
+	"nonbreakingspace": "\u00a0",
+	"notequal":         "\u2260",
+	"ntilde":           "\u00f1",
+	"numbersign":       "#",
+	"o":                "o",
+	"oacute":           "\u00f3",
+	"ocircumflex":      "\u00f4",
+	"odieresis":        "\u00f6",
+	"oe":               "\u0153",
+	"ogonek":           "\u02db",
+	"ograve":           "\u00f2",
+	"one":              "1",
+	"onehalf":          "\u00bd",
+	"onequarter":       "\u00bc",
+	"onesuperior":      "\u00b9",
+	"ordfeminine":      "\u00aa",
+	"ordmasculine":     "\u00ba",
+	"oslash":           "\u00f8",
+	"otilde":           "\u00f5",
+	"p":                "p",
+	"paragraph":        "\u00b6",
+	"parenleft":        "(",
+	"parenright":       ")",
+	"partialdiff":      "\u2202",
+	"percent":          "%",
+	"period":           ".",
+	"periodcentered":   "\u00b7",
+	"perthousand":      "\u2030",
+	"pi":               "\u03c0",
+	"plus":             "+",
+	"plusminus":        "\u00b1",
+	"product":          "\u220f",
+	"q":                "q",
+	"question":         "?",
+	"questiondown":     "\u00bf",
+	"quotedbl":         "\"",
+	"quotedblbase":     "\u201e",
+	"quotedblleft":     "\u201c",
+	"quotedblright":    "\u201d",
+	"quoteleft":        "\u2018",
+	"quoteright":       "\u2019",
+	"quotesinglbase":   "\u201a",
+	"quotesingle":      "'",
+	"r":                "r",
+	"radical":          "\u221a",
+	"registered":       "\u00ae",
+	"ring":             "\u02da",
+	"s":                "s",
+	"scaron":           "\u0161",
+	"scedilla":         "\u015f",
+	"section":          "\u00a7",
+	"semicolon":        ";",
+	"seven":            "7",
+	"sfthyphen":        "\u00ad",
+	"six":              "6",
+	"slash":            "/",
+	"space":            " ",
+	"sterling":         "\u00a3",
+	"summation":        "\u2211",
+	"t":                "t",
+	"thorn":            "\u00fe",
+	"three":            "3",
+	"threequarters":    "\u00be",
+	"threesuperior":    "\u00b3",
+	"tilde":            "\u02dc",
+	"trademark":        "\u2122",
+	"two":              "2",
+	"twosuperior":      "\u00b2",
+	"u":                "u",
+	"uacute":           "\u00fa",
+	"ucircumflex":      "\u00fb",
+	"udieresis":        "\u00fc",
+	"ugrave":           "\u00f9",
+	"underscore":       "_",
+	"v":                "v",
+	"w":                "w",
+	"x":                "x",
+	"y":                "y",
+	"yacute":           "\u00fd",
+	"ydieresis":        "\u00ff",
+	"yen":              "\u00a5",
+	"z":                "z",
+	"zcaron":           "\u017e",
+	"zero":             "0",
+}
+
+// mac_glyph_names is the standard Macintosh ordering of glyphs used by the
+// TrueType post table.
+var mac_glyph_names = [258]string{
+	".notdef", ".null", "nonmarkingreturn", "space", "exclam", "quotedbl",
+	"numbersign", "dollar", "percent", "ampersand", "quotesingle", "parenleft",
+	"parenright", "asterisk", "plus", "comma", "hyphen", "period",
+	"slash", "zero", "one", "two", "three", "four",
+	"five", "six", "seven", "eight", "nine", "colon",
+	"semicolon", "less", "equal", "greater", "question", "at",
+	"A", "B", "C", "D", "E", "F",
+	"G", "H", "I", "J", "K", "L",
+	"M", "N", "O", "P", "Q", "R",
+	"S", "T", "U", "V", "W", "X",
+	"Y", "Z", "bracketleft", "backslash", "bracketright", "asciicircum",
+	"underscore", "grave", "a", "b", "c", "d",
+	"e", "f", "g", "h", "i", "j",
+	"k", "l", "m", "n", "o", "p",
+	"q", "r", "s", "t", "u", "v",
+	"w", "x", "y", "z", "braceleft", "bar",
+	"braceright", "asciitilde", "Adieresis", "Aring", "Ccedilla", "Eacute",
+	"Ntilde", "Odieresis", "Udieresis", "aacute", "agrave", "acircumflex",
+	"adieresis", "atilde", "aring", "ccedilla", "eacute", "egrave",
+	"ecircumflex", "edieresis", "iacute", "igrave", "icircumflex", "idieresis",
+	"ntilde", "oacute", "ograve", "ocircumflex", "odieresis", "otilde",
+	"uacute", "ugrave", "ucircumflex", "udieresis", "dagger", "degree",
+	"cent", "sterling", "section", "bullet", "paragraph", "germandbls",
+	"registered", "copyright", "trademark", "acute", "dieresis", "notequal",
+	"AE", "Oslash", "infinity", "plusminus", "lessequal", "greaterequal",
+	"yen", "mu", "partialdiff", "summation", "product", "pi",
+	"integral", "ordfeminine", "ordmasculine", "Omega", "ae", "oslash",
+	"questiondown", "exclamdown", "logicalnot", "radical", "florin", "approxequal",
+	"Delta", "guillemotleft", "guillemotright", "ellipsis", "nonbreakingspace", "Agrave",
+	"Atilde", "Otilde", "OE", "oe", "endash", "emdash",
+	"quotedblleft", "quotedblright", "quoteleft", "quoteright", "divide", "lozenge",
+	"ydieresis", "Ydieresis", "fraction", "currency", "guilsinglleft", "guilsinglright",
+	"fi", "fl", "daggerdbl", "periodcentered", "quotesinglbase", "quotedblbase",
+	"perthousand", "Acircumflex", "Ecircumflex", "Aacute", "Edieresis", "Egrave",
+	"Iacute", "Icircumflex", "Idieresis", "Igrave", "Oacute", "Ocircumflex",
+	"apple", "Ograve", "Uacute", "Ucircumflex", "Ugrave", "dotlessi",
+	"circumflex", "tilde", "macron", "breve", "dotaccent", "ring",
+	"cedilla", "hungarumlaut", "ogonek", "caron", "Lslash", "lslash",
+	"Scaron", "scaron", "Zcaron", "zcaron", "brokenbar", "Eth",
+	"eth", "Yacute", "yacute", "Thorn", "thorn", "minus",
+	"multiply", "onesuperior", "twosuperior", "threesuperior", "onehalf", "onequarter",
+	"threequarters", "franc", "Gbreve", "gbreve", "Idotaccent", "Scedilla",
+	"scedilla", "Cacute", "cacute", "Ccaron", "ccaron", "dcroat",
+}
+
+// cff_standard_strings are the predefined strings of CFF fonts, indexed by SID.
+var cff_standard_strings = [391]string{
+	".notdef", "space", "exclam", "quotedbl", "numbersign", "dollar",
+	"percent", "ampersand", "quoteright", "parenleft", "parenright", "asterisk",
+	"plus", "comma", "hyphen", "period", "slash", "zero",
+	"one", "two", "three", "four", "five", "six",
+	"seven", "eight", "nine", "colon", "semicolon", "less",
+	"equal", "greater", "question", "at", "A", "B",
+	"C", "D", "E", "F", "G", "H",
+	"I", "J", "K", "L", "M", "N",
+	"O", "P", "Q", "R", "S", "T",
+	"U", "V", "W", "X", "Y", "Z",
+	"bracketleft", "backslash", "bracketright", "asciicircum", "underscore", "quoteleft",
+	"a", "b", "c", "d", "e", "f",
+	"g", "h", "i", "j", "k", "l",
+	"m", "n", "o", "p", "q", "r",
+	"s", "t", "u", "v", "w", "x",
+	"y", "z", "braceleft", "bar", "braceright", "asciitilde",
+	"exclamdown", "cent", "sterling", "fraction", "yen", "florin",
+	"section", "currency", "quotesingle", "quotedblleft", "guillemotleft", "guilsinglleft",
+	"guilsinglright", "fi", "fl", "endash", "dagger", "daggerdbl",
+	"periodcentered", "paragraph", "bullet", "quotesinglbase", "quotedblbase", "quotedblright",
+	"guillemotright", "ellipsis", "perthousand", "questiondown", "grave", "acute",
+	"circumflex", "tilde", "macron", "breve", "dotaccent", "dieresis",
+	"ring", "cedilla", "hungarumlaut", "ogonek", "caron", "emdash",
+	"AE", "ordfeminine", "Lslash", "Oslash", "OE", "ordmasculine",
+	"ae", "dotlessi", "lslash", "oslash", "oe", "germandbls",
+	"onesuperior", "logicalnot", "mu", "trademark", "Eth", "onehalf",
+	"plusminus", "Thorn", "onequarter", "divide", "brokenbar", "degree",
+	"thorn", "threequarters", "twosuperior", "registered", "minus", "eth",
+	"multiply", "threesuperior", "copyright", "Aacute", "Acircumflex", "Adieresis",
+	"Agrave", "Aring", "Atilde", "Ccedilla", "Eacute", "Ecircumflex",
+	"Edieresis", "Egrave", "Iacute", "Icircumflex", "Idieresis", "Igrave",
+	"Ntilde", "Oacute", "Ocircumflex", "Odieresis", "Ograve", "Otilde",
+	"Scaron", "Uacute", "Ucircumflex", "Udieresis", "Ugrave", "Yacute",
+	"Ydieresis", "Zcaron", "aacute", "acircumflex", "adieresis", "agrave",
+	"aring", "atilde", "ccedilla", "eacute", "ecircumflex", "edieresis",
+	"egrave", "iacute", "icircumflex", "idieresis", "igrave", "ntilde",
+	"oacute", "ocircumflex", "odieresis", "ograve", "otilde", "scaron",
+	"uacute", "ucircumflex", "udieresis", "ugrave", "yacute", "ydieresis",
+	"zcaron", "exclamsmall", "Hungarumlautsmall", "dollaroldstyle", "dollarsuperior", "ampersandsmall",
+	"Acutesmall", "parenleftsuperior", "parenrightsuperior", "twodotenleader", "onedotenleader", "zerooldstyle",
+	"oneoldstyle", "twooldstyle", "threeoldstyle", "fouroldstyle", "fiveoldstyle", "sixoldstyle",
+	"sevenoldstyle", "eightoldstyle", "nineoldstyle", "commasuperior", "threequartersemdash", "periodsuperior",
+	"questionsmall", "asuperior", "bsuperior", "centsuperior", "dsuperior", "esuperior",
+	"isuperior", "lsuperior", "msuperior", "nsuperior", "osuperior", "rsuperior",
+	"ssuperior", "tsuperior", "ff", "ffi", "ffl", "parenleftinferior",
+	"parenrightinferior", "Circumflexsmall", "hyphensuperior", "Gravesmall", "Asmall", "Bsmall",
+	"Csmall", "Dsmall", "Esmall", "Fsmall", "Gsmall", "Hsmall",
+	"Ismall", "Jsmall", "Ksmall", "Lsmall", "Msmall", "Nsmall",
+	"Osmall", "Psmall", "Qsmall", "Rsmall", "Ssmall", "Tsmall",
+	"Usmall", "Vsmall", "Wsmall", "Xsmall", "Ysmall", "Zsmall",
+	"colonmonetary", "onefitted", "rupiah", "Tildesmall", "exclamdownsmall", "centoldstyle",
+	"Lslashsmall", "Scaronsmall", "Zcaronsmall", "Dieresissmall", "Brevesmall", "Caronsmall",
+	"Dotaccentsmall", "Macronsmall", "figuredash", "hypheninferior", "Ogoneksmall", "Ringsmall",
+	"Cedillasmall", "questiondownsmall", "oneeighth", "threeeighths", "fiveeighths", "seveneighths",
+	"onethird", "twothirds", "zerosuperior", "foursuperior", "fivesuperior", "sixsuperior",
+	"sevensuperior", "eightsuperior", "ninesuperior", "zeroinferior", "oneinferior", "twoinferior",
+	"threeinferior", "fourinferior", "fiveinferior", "sixinferior", "seveninferior", "eightinferior",
+	"nineinferior", "centinferior", "dollarinferior", "periodinferior", "commainferior", "Agravesmall",
+	"Aacutesmall", "Acircumflexsmall", "Atildesmall", "Adieresissmall", "Aringsmall", "AEsmall",
+	"Ccedillasmall", "Egravesmall", "Eacutesmall", "Ecircumflexsmall", "Edieresissmall", "Igravesmall",
+	"Iacutesmall", "Icircumflexsmall", "Idieresissmall", "Ethsmall", "Ntildesmall", "Ogravesmall",
+	"Oacutesmall", "Ocircumflexsmall", "Otildesmall", "Odieresissmall", "OEsmall", "Oslashsmall",
+	"Ugravesmall", "Uacutesmall", "Ucircumflexsmall", "Udieresissmall", "Yacutesmall", "Thornsmall",
+	"Ydieresissmall", "001.000", "001.001", "001.002", "001.003", "Black",
+	"Bold", "Book", "Light", "Medium", "Regular", "Roman",
+	"Semibold",
+}
+
+// standard_encoding is the Adobe StandardEncoding used by Type1 and CFF fonts.
+var standard_encoding = map[byte]string{
+	32:  "space",
+	33:  "exclam",
+	34:  "quotedbl",
+	35:  "numbersign",
+	36:  "dollar",
+	37:  "percent",
+	38:  "ampersand",
+	39:  "quoteright",
+	40:  "parenleft",
+	41:  "parenright",
+	42:  "asterisk",
+	43:  "plus",
+	44:  "comma",
+	45:  "hyphen",
+	46:  "period",
+	47:  "slash",
+	48:  "zero",
+	49:  "one",
+	50:  "two",
+	51:  "three",
+	52:  "four",
+	53:  "five",
+	54:  "six",
+	55:  "seven",
+	56:  "eight",
+	57:  "nine",
+	58:  "colon",
+	59:  "semicolon",
+	60:  "less",
+	61:  "equal",
+	62:  "greater",
+	63:  "question",
+	64:  "at",
+	65:  "A",
+	66:  "B",
+	67:  "C",
+	68:  "D",
+	69:  "E",
+	70:  "F",
+	71:  "G",
+	72:  "H",
+	73:  "I",
+	74:  "J",
+	75:  "K",
+	76:  "L",
+	77:  "M",
+	78:  "N",
+	79:  "O",
+	80:  "P",
+	81:  "Q",
+	82:  "R",
+	83:  "S",
+	84:  "T",
+	85:  "U",
+	86:  "V",
+	87:  "W",
+	88:  "X",
+	89:  "Y",
+	90:  "Z",
+	91:  "bracketleft",
+	92:  "backslash",
+	93:  "bracketright",
+	94:  "asciicircum",
+	95:  "underscore",
+	96:  "quoteleft",
+	97:  "a",
+	98:  "b",
+	99:  "c",
+	100: "d",
+	101: "e",
+	102: "f",
+	103: "g",
+	104: "h",
+	105: "i",
+	106: "j",
+	107: "k",
+	108: "l",
+	109: "m",
+	110: "n",
+	111: "o",
+	112: "p",
+	113: "q",
+	114: "r",
+	115: "s",
+	116: "t",
+	117: "u",
+	118: "v",
+	119: "w",
+	120: "x",
+	121: "y",
+	122: "z",
+	123: "braceleft",
+	124: "bar",
+	125: "braceright",
+	126: "asciitilde",
+	161: "exclamdown",
+	162: "cent",
+	163: "sterling",
+	164: "fraction",
+	165: "yen",
+	166: "florin",
+	167: "section",
+	168: "currency",
+	169: "quotesingle",
+	170: "quotedblleft",
+	171: "guillemotleft",
+	172: "guilsinglleft",
+	173: "guilsinglright",
+	174: "fi",
+	175: "fl",
+	177: "endash",
+	178: "dagger",
+	179: "daggerdbl",
+	180: "periodcentered",
+	182: "paragraph",
+	183: "bullet",
+	184: "quotesinglbase",
+	185: "quotedblbase",
+	186: "quotedblright",
+	187: "guillemotright",
+	188: "ellipsis",
+	189: "perthousand",
+	191: "questiondown",
+	193: "grave",
+	194: "acute",
+	195: "circumflex",
+	196: "tilde",
+	197: "macron",
+	198: "breve",
+	199: "dotaccent",
+	200: "dieresis",
+	202: "ring",
+	203: "cedilla",
+	205: "hungarumlaut",
+	206: "ogonek",
+	207: "caron",
+	208: "emdash",
+	225: "AE",
+	227: "ordfeminine",
+	232: "Lslash",
+	233: "Oslash",
+	234: "OE",
+	235: "ordmasculine",
+	241: "ae",
+	245: "dotlessi",
+	248: "lslash",
+	249: "oslash",
+	250: "oe",
+	251: "germandbls",
+}
@@ -0,0 +1,317 @@
+package pdf
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// What the parser saw of the document, to find why a document is not read as
+// expected. The objects are written back in the PDF syntax, like
+// `qpdf --show-object`.
+
+// XRefEntry is where an object is according to the cross-reference sections.
+type XRefEntry struct {
+	Id     int
+	Kind   string // "free", "offset" or "objstm"
+	Offset int64  // "offset", where the object starts in the file
+	Stream int    // "objstm", the object stream with the object and its index in it
+	Index  int
+}
+
+// ObjectInfo describes an indirect object of the document.
+type ObjectInfo struct {
+	Id     int
+	Type   string // /Type and /Subtype of dictionaries and streams, the kind of value otherwise
+	Stream bool
+	Length int // of the encoded stream
+}
+
+// XRef returns the cross-reference entries by object id. Documents read with
+// Parse only have the ones of the xref tables.
+func (p pdf) XRef() []XRefEntry {
+	var result []XRefEntry
+	if p.src != nil {
+		for id, e := range p.src.xref {
+			entry := XRefEntry{Id: int(id)}
+			switch e.kind {
+			case 0:
+				entry.Kind = "free"
+			case 1:
+				entry.Kind, entry.Offset = "offset", e.offset
+			case 2:
+				entry.Kind, entry.Stream, entry.Index = "objstm", int(e.stream), e.index
+			}
+			result = append(result, entry)
+		}
+	} else {
+		for _, o := range p.objs {
+			xref, ok := o.Type.(obj_xref)
+			if !ok {
+				continue
+			}
+			for i, ref := range xref.refs {
+				entry := XRefEntry{Id: int(xref.id) + i, Kind: "free"}
+				if ref.c == "n" {
+					entry.Kind, entry.Offset = "offset", int64(ref.n)
+				}
+				result = append(result, entry)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result
+}
+
+// Trailer returns the trailer dictionary in the PDF syntax.
+func (p pdf) Trailer() string {
+	return format_obj(obj{p.trailer(), 0, 0}, "", false)
+}
+
+// object_ids returns the ids of the objects of the document, sorted.
+func (p *pdf) object_ids() []obj_int {
+	var ids []obj_int
+	if p.src != nil {
+		for id, e := range p.src.xref {
+			if e.kind != 0 {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		seen := map[obj_int]bool{}
+		for _, o := range p.objs {
+			ind, ok := o.Type.(obj_ind)
+			if !ok {
+				continue
+			}
+			seen[ind.id] = true
+			if ind.metadata["Type"].Type != obj_named("ObjStm") {
+				continue
+			}
+			n, _ := ind.metadata["N"].Type.(obj_int)
+			for i := 0; i < int(n) && i*2 < len(ind.stream.objs); i++ {
+				if id, ok := ind.stream.objs[i*2].Type.(obj_int); ok {
+					seen[id] = true
+				}
+			}
+		}
+		for id := range seen {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Objects returns the indirect objects of the document, sorted by id.
+func (p pdf) Objects() []ObjectInfo {
+	var result []ObjectInfo
+	for _, id := range p.object_ids() {
+		ind, err := p.lookup(id)
+		if err != nil {
+			result = append(result, ObjectInfo{Id: int(id), Type: "missing"})
+			continue
+		}
+		info := ObjectInfo{Id: int(id)}
+		info.Stream = ind.stream.encoded_content != nil || ind.stream.decoded_content != nil || ind.stream.objs != nil
+		if info.Stream {
+			info.Length = len(ind.stream.encoded_content)
+			if info.Length == 0 {
+				info.Length = len(ind.stream.decoded_content)
+			}
+		}
+		switch {
+		case ind.metadata != nil:
+			info.Type = dict_type(ind.metadata, info.Stream)
+		case len(ind.objs) > 0:
+			info.Type = value_kind(ind.objs[len(ind.objs)-1])
+		default:
+			info.Type = "null"
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// dict_type returns `/Type /Subtype` of a dictionary, `dict` or `stream` without them.
+func dict_type(dict obj_dict, stream bool) string {
+	var names []string
+	for _, key := range []obj_named{"Type", "Subtype"} {
+		if v, ok := dict[key].Type.(obj_named); ok {
+			names = append(names, "/"+string(v))
+		}
+	}
+	if len(names) > 0 {
+		return strings.Join(names, " ")
+	}
+	if stream {
+		return "stream"
+	}
+	return "dict"
+}
+
+func value_kind(o obj) string {
+	switch o.Type.(type) {
+	case obj_int, obj_real:
+		return "number"
+	case obj_strl, obj_strh:
+		return "string"
+	case obj_named:
+		return "name"
+	case obj_array:
+		return "array"
+	case obj_bool:
+		return "bool"
+	case obj_ref:
+		return "ref"
+	case obj_dict:
+		return "dict"
+	}
+	return "null"
+}
+
+// Object returns the object `id` in the PDF syntax, the data of streams is
+// replaced by its size, see Stream.
+func (p pdf) Object(id int) (string, error) {
+	ind, err := p.lookup(obj_int(id))
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("ERROR: could not find obj %d", id))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %d obj\n", ind.id, ind.mod_id)
+	if ind.metadata != nil {
+		b.WriteString(format_obj(obj{ind.metadata, 0, 0}, "", false))
+		b.WriteString("\n")
+	} else {
+		for _, o := range ind.objs {
+			b.WriteString(format_obj(o, "", false))
+			b.WriteString("\n")
+		}
+	}
+	if ind.stream.encoded_content != nil || ind.stream.decoded_content != nil || ind.stream.objs != nil {
+		length := len(ind.stream.encoded_content)
+		if length == 0 {
+			length = len(ind.stream.decoded_content)
+		}
+		fmt.Fprintf(&b, "stream\n%% %d bytes\nendstream\n", length)
+	}
+	b.WriteString("endobj\n")
+	return b.String(), nil
+}
+
+// Stream returns the data of the stream of the object `id`, with its /Filter
+// list applied when `decoded`.
+func (p pdf) Stream(id int, decoded bool) ([]byte, error) {
+	ind, err := p.lookup(obj_int(id))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("ERROR: could not find obj %d", id))
+	}
+	if ind.stream.encoded_content == nil && ind.stream.decoded_content == nil && ind.stream.objs == nil {
+		return nil, errors.New(fmt.Sprintf("ERROR: obj %d is not a stream", id))
+	}
+	if !decoded {
+		if ind.stream.encoded_content != nil {
+			return ind.stream.encoded_content, nil
+		}
+		return ind.stream.decoded_content, nil
+	}
+	return p.decode_stream(ind)
+}
+
+// format_obj writes `o` in the PDF syntax, the entries of dictionaries go in
+// their own lines after `indent` unless `inline`.
+func format_obj(o obj, indent string, inline bool) string {
+	switch v := o.Type.(type) {
+	case obj_int:
+		return strconv.Itoa(int(v))
+	case obj_real:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64)
+	case obj_bool:
+		return strconv.FormatBool(bool(v))
+	case obj_named:
+		return format_name(v)
+	case obj_ref:
+		return fmt.Sprintf("%d %d R", v.id, v.mod_id)
+	case obj_strl:
+		return format_strl(string(v))
+	case obj_strh:
+		return "<" + hex.EncodeToString([]byte(v)) + ">"
+	case obj_array:
+		items := make([]string, len(v))
+		for i := range v {
+			items[i] = format_obj(v[i], indent, inline)
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case obj_dict:
+		if len(v) == 0 {
+			return "<< >>"
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		if inline {
+			items := make([]string, len(keys))
+			for i, k := range keys {
+				items[i] = format_name(obj_named(k)) + " " + format_obj(v[obj_named(k)], "", true)
+			}
+			return "<<" + strings.Join(items, " ") + ">>"
+		}
+		var b strings.Builder
+		b.WriteString("<<\n")
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s  %s %s\n", indent, format_name(obj_named(k)), format_obj(v[obj_named(k)], indent+"  ", false))
+		}
+		b.WriteString(indent + ">>")
+		return b.String()
+	case obj_ind:
+		return fmt.Sprintf("%d %d R", v.id, v.mod_id)
+	}
+	return "null"
+}
+
+// format_name escapes the characters that can't be in a name as `#xx`.
+func format_name(name obj_named) string {
+	var b strings.Builder
+	b.WriteString("/")
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < '!' || c > '~' || c == '#' || is_delimiter(c) {
+			fmt.Fprintf(&b, "#%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// format_strl writes a literal string, escaping what unescape_strl reads back.
+func format_strl(s string) string {
+	var b strings.Builder
+	b.WriteString("(")
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteString(")")
+	return b.String()
+}
@@ -0,0 +1,202 @@
+package pdf
+
+import (
+	"bytes"
+)
+
+// The lexical conventions of ISO 32000-1 7.2. The document is read by byte
+// offset, so tokens, strings and dictionaries may span lines and a line may end
+// with CR, LF or CR LF.
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf#page=20
+
+func is_whitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func is_delimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+type lexer struct {
+	doc        []byte
+	pos        int
+	line       int // line of pos, from 1
+	line_start int // where the line of pos starts
+	tok_line   int // where the last token returned by next starts, for the objs and errors
+	tok_col    int
+}
+
+func new_lexer(doc []byte) *lexer {
+	return &lexer{doc: doc, line: 1}
+}
+
+// advance moves to `pos`, counting the lines on the way.
+func (l *lexer) advance(pos int) {
+	if pos > len(l.doc) {
+		pos = len(l.doc)
+	}
+	for ; l.pos < pos; l.pos++ {
+		c := l.doc[l.pos]
+		if c == '\n' || (c == '\r' && (l.pos+1 == len(l.doc) || l.doc[l.pos+1] != '\n')) {
+			l.line++
+			l.line_start = l.pos + 1
+		}
+	}
+}
+
+// next skips the white space and returns the next token. The delimiters are
+// tokens by themselves, but `<<` and `>>`. Comments, strings and names are
+// returned as their first delimiter, the rest is read with read_comment,
+// read_strl, read_strh and read_name.
+func (l *lexer) next() (string, bool) {
+	i := l.pos
+	for i < len(l.doc) && is_whitespace(l.doc[i]) {
+		i++
+	}
+	l.advance(i)
+	if l.pos == len(l.doc) {
+		return "", false
+	}
+	l.tok_line, l.tok_col = l.line, l.pos-l.line_start+1
+	end := l.pos + 1
+	if c := l.doc[l.pos]; is_delimiter(c) {
+		if (c == '<' || c == '>') && end < len(l.doc) && l.doc[end] == c {
+			end++
+		}
+	} else {
+		for end < len(l.doc) && !is_whitespace(l.doc[end]) && !is_delimiter(l.doc[end]) {
+			end++
+		}
+	}
+	token := string(l.doc[l.pos:end])
+	l.advance(end)
+	return token, true
+}
+
+// read_comment returns the rest of the line after a `%`.
+func (l *lexer) read_comment() string {
+	end := l.pos
+	for end < len(l.doc) && l.doc[end] != '\n' && l.doc[end] != '\r' {
+		end++
+	}
+	comment := string(l.doc[l.pos:end])
+	l.advance(end)
+	return comment
+}
+
+// read_strl returns the bytes of a literal string after its `(`, still escaped,
+// and how many parentheses were left open.
+func (l *lexer) read_strl() (obj_strl, int) {
+	strl, balance := read_strl(l.doc[l.pos:])
+	l.advance(l.pos + len(strl) + 1)
+	return strl, balance
+}
+
+// read_strh returns the digits of a hexadecimal string after its `<`.
+func (l *lexer) read_strh() (string, error) {
+	strh, err := read_strh(l.doc[l.pos:])
+	l.advance(l.pos + len(strh) + 1)
+	return strh, err
+}
+
+// read_name returns a name after its `/`, with the `#xx` escapes replaced by
+// the bytes they stand for, `/A#20B` is `A B`.
+func (l *lexer) read_name() string {
+	end := l.pos
+	for end < len(l.doc) && !is_whitespace(l.doc[end]) && !is_delimiter(l.doc[end]) {
+		end++
+	}
+	raw := l.doc[l.pos:end]
+	l.advance(end)
+	if bytes.IndexByte(raw, '#') == -1 {
+		return string(raw)
+	}
+	name := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) && is_hex(raw[i+1]) && is_hex(raw[i+2]) {
+			name = append(name, unhex(raw[i+1])<<4|unhex(raw[i+2]))
+			i += 2
+			continue
+		}
+		name = append(name, raw[i])
+	}
+	return string(name)
+}
+
+func is_hex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// read_stream returns the data of a stream after the `stream` keyword. `length`
+// is the /Length of the stream, -1 when it is not known(an indirect object).
+// Without it, or when it is wrong, the data goes until `endstream`.
+func (l *lexer) read_stream(length int) []byte {
+	start := l.pos
+	// the keyword is followed by CR LF or LF
+	if start < len(l.doc) && l.doc[start] == '\r' {
+		start++
+	}
+	if start < len(l.doc) && l.doc[start] == '\n' {
+		start++
+	}
+	end := -1
+	if length >= 0 && start+length <= len(l.doc) {
+		rest := bytes.TrimLeft(l.doc[start+length:], "\x00\t\n\f\r ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			end = start + length
+		}
+	}
+	if end == -1 {
+		end = len(l.doc)
+		if i, err := get_endstream(l.doc[start:]); err == nil {
+			end = start + i
+			// the end of line before `endstream` is not part of the data
+			if end > start && l.doc[end-1] == '\n' {
+				end--
+			}
+			if end > start && l.doc[end-1] == '\r' {
+				end--
+			}
+		}
+	}
+	l.advance(end)
+	return l.doc[start:end]
+}
+
+// read_inline_image returns the data of an inline image after `ID`, the `EI`
+// that ends it is consumed.
+func (l *lexer) read_inline_image() []byte {
+	start := l.pos
+	// a single white space after `ID`
+	if start < len(l.doc) && is_whitespace(l.doc[start]) {
+		start++
+	}
+	for i := start; i+1 < len(l.doc); i++ {
+		if l.doc[i] == 'E' && l.doc[i+1] == 'I' &&
+			(i == start || is_whitespace(l.doc[i-1])) &&
+			(i+2 == len(l.doc) || is_whitespace(l.doc[i+2]) || is_delimiter(l.doc[i+2])) {
+			l.advance(i + 2)
+			return l.doc[start:i]
+		}
+	}
+	l.advance(len(l.doc))
+	return l.doc[start:]
+}
@@ -0,0 +1,203 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata of the document from the trailer /Info and the XMP packet of the
+// catalog /Metadata. /Info has precedence, XMP fills what is missing.
+type Metadata struct {
+	Title        string
+	Author       string
+	Subject      string
+	Keywords     string
+	Creator      string // the application that created the original document
+	Producer     string // the application that converted it to PDF
+	CreationDate time.Time
+	ModDate      time.Time
+	XMP          map[string]string // XMP properties as `prefix:name`, like `dc:title` and `pdf:Producer`
+}
+
+func (p *pdf) metadata() Metadata {
+	var result Metadata
+	if info := p.resolve_dict(p.trailer()["Info"]); info != nil {
+		text := func(key obj_named) string {
+			s, _ := p.resolve_text(info[key])
+			return strings.TrimSpace(s)
+		}
+		result.Title = text("Title")
+		result.Author = text("Author")
+		result.Subject = text("Subject")
+		result.Keywords = text("Keywords")
+		result.Creator = text("Creator")
+		result.Producer = text("Producer")
+		result.CreationDate, _ = parse_date(text("CreationDate"))
+		result.ModDate, _ = parse_date(text("ModDate"))
+	}
+
+	catalog := p.catalog()
+	if catalog == nil {
+		return result
+	}
+	stream, ok := p.resolve(catalog["Metadata"]).Type.(obj_ind)
+	if !ok {
+		return result
+	}
+	data, err := p.decode_stream(stream)
+	if err != nil {
+		return result
+	}
+	result.XMP = parse_xmp(data)
+	fill := func(s *string, keys ...string) {
+		for _, key := range keys {
+			if *s == "" {
+				*s = result.XMP[key]
+			}
+		}
+	}
+	fill(&result.Title, "dc:title")
+	fill(&result.Author, "dc:creator")
+	fill(&result.Subject, "dc:description")
+	fill(&result.Keywords, "pdf:Keywords")
+	fill(&result.Creator, "xmp:CreatorTool")
+	fill(&result.Producer, "pdf:Producer")
+	if result.CreationDate.IsZero() {
+		result.CreationDate, _ = parse_xmp_date(result.XMP["xmp:CreateDate"])
+	}
+	if result.ModDate.IsZero() {
+		result.ModDate, _ = parse_xmp_date(result.XMP["xmp:ModifyDate"])
+	}
+	return result
+}
+
+// parse_date parses a PDF date, `D:YYYYMMDDHHmmSSOHH'mm'`. Everything after the
+// year is optional, O is the relation to UTC: `+`, `-` or `Z`.
+func parse_date(s string) (time.Time, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	if len(s) < 4 {
+		return time.Time{}, errors.New(fmt.Sprintf("invalid date `%s`", s))
+	}
+	// year, month, day, hour, minute and second with their default values
+	fields := []int{0, 1, 1, 0, 0, 0}
+	sizes := []int{4, 2, 2, 2, 2, 2}
+	pos := 0
+	for i, size := range sizes {
+		if pos+size > len(s) || s[pos] < '0' || s[pos] > '9' {
+			break
+		}
+		v, err := strconv.Atoi(s[pos : pos+size])
+		if err != nil {
+			return time.Time{}, errors.New(fmt.Sprintf("invalid date `%s`", s))
+		}
+		fields[i] = v
+		pos += size
+	}
+	loc := time.UTC
+	if pos < len(s) && (s[pos] == '+' || s[pos] == '-') {
+		sign := 1
+		if s[pos] == '-' {
+			sign = -1
+		}
+		// HH'mm' with the apostrophes optional
+		tz := strings.ReplaceAll(s[pos+1:], "'", "")
+		var hours, minutes int
+		if len(tz) >= 2 {
+			hours, _ = strconv.Atoi(tz[:2])
+		}
+		if len(tz) >= 4 {
+			minutes, _ = strconv.Atoi(tz[2:4])
+		}
+		loc = time.FixedZone("", sign*(hours*3600+minutes*60))
+	}
+	return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, loc), nil
+}
+
+func parse_xmp_date(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("invalid date `%s`", s))
+}
+
+// xmp_prefixes are the usual prefixes of the XMP namespaces, the documents may
+// use others.
+var xmp_prefixes = map[string]string{
+	"http://purl.org/dc/elements/1.1/":            "dc",
+	"http://ns.adobe.com/xap/1.0/":                "xmp",
+	"http://ns.adobe.com/pdf/1.3/":                "pdf",
+	"http://ns.adobe.com/xap/1.0/mm/":             "xmpMM",
+	"http://ns.adobe.com/xap/1.0/rights/":         "xmpRights",
+	"http://ns.adobe.com/photoshop/1.0/":          "photoshop",
+	"http://www.aiim.org/pdfa/ns/id/":             "pdfaid",
+	"http://www.aiim.org/pdfua/ns/id/":            "pdfuaid",
+	"http://www.w3.org/1999/02/22-rdf-syntax-ns#": "rdf",
+}
+
+// parse_xmp returns the simple properties of the XMP packet. Arrays(rdf:Seq,
+// rdf:Bag and rdf:Alt) are joined with `, `.
+func parse_xmp(data []byte) map[string]string {
+	result := map[string]string{}
+	name := func(n xml.Name) string {
+		if prefix, ok := xmp_prefixes[n.Space]; ok {
+			return prefix + ":" + n.Local
+		}
+		return n.Space + ":" + n.Local
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	var property string // the property of rdf:Description being read
+	var text strings.Builder
+	var items []string
+	for {
+		token, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := name(t.Name)
+			switch {
+			case n == "rdf:Description":
+				// abbreviated form, the properties are attributes
+				for _, attr := range t.Attr {
+					if attr.Name.Space != "" && attr.Name.Space != "xmlns" && name(attr.Name) != "rdf:about" {
+						result[name(attr.Name)] = strings.TrimSpace(attr.Value)
+					}
+				}
+			case property == "" && !strings.HasPrefix(n, "rdf:") && !strings.HasPrefix(n, "adobe:ns:meta/:"):
+				property = n
+				text.Reset()
+				items = nil
+			case n == "rdf:li":
+				text.Reset()
+			}
+		case xml.CharData:
+			if property != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			n := name(t.Name)
+			switch {
+			case n == "rdf:li":
+				items = append(items, strings.TrimSpace(text.String()))
+				text.Reset()
+			case n == property:
+				if items != nil {
+					result[property] = strings.Join(items, ", ")
+				} else {
+					result[property] = strings.TrimSpace(text.String())
+				}
+				property = ""
+			}
+		}
+	}
+	return result
+}
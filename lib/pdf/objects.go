@@ -0,0 +1,350 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// lookup returns the indirect object `id`. Objects stored inside an object
+// stream (/Type /ObjStm) are returned as if they were written as `id 0 obj`.
+func (p *pdf) lookup(id obj_int) (obj_ind, error) {
+	if p.src != nil {
+		return p.src.lookup(p, id)
+	}
+	o, err := get_obj_by_id(p.objs, id)
+	if err == nil {
+		return o.Type.(obj_ind), nil
+	}
+	for _, o := range p.objs {
+		ind, ok := o.Type.(obj_ind)
+		if !ok || ind.metadata["Type"].Type != obj_named("ObjStm") {
+			continue
+		}
+		if result, ok := objstm_get(ind, id); ok {
+			return result, nil
+		}
+	}
+	return obj_ind{}, errors.New(fmt.Sprintf("ERROR: could not find obj %d\n", id))
+}
+
+// objstm_get returns the object `id` of the parsed object stream `ind`.
+func objstm_get(ind obj_ind, id obj_int) (obj_ind, bool) {
+	n, _ := ind.metadata["N"].Type.(obj_int)
+	if int(n)*3 > len(ind.stream.objs) {
+		return obj_ind{}, false
+	}
+	// the stream starts with N pairs of `id offset` followed by the N objects
+	for i := 0; i < int(n); i++ {
+		_id, ok := ind.stream.objs[i*2].Type.(obj_int)
+		if !ok || _id != id {
+			continue
+		}
+		o := ind.stream.objs[int(n)*2+i]
+		result := obj_ind{id: id}
+		if dict, ok := o.Type.(obj_dict); ok {
+			result.metadata = dict
+		} else {
+			result.objs = []obj{o}
+		}
+		return result, true
+	}
+	return obj_ind{}, false
+}
+
+// resolve follows `o` if it is a reference. Dictionaries and other direct values
+// are returned as they are, streams are returned as the obj_ind holding them.
+func (p *pdf) resolve(o obj) obj {
+	ref, ok := o.Type.(obj_ref)
+	if !ok {
+		return o
+	}
+	ind, err := p.lookup(ref.id)
+	if err != nil {
+		return obj{nil, o.line, o.col}
+	}
+	if ind.stream.encoded_content != nil || ind.stream.decoded_content != nil || ind.stream.objs != nil {
+		return obj{ind, o.line, o.col}
+	}
+	if ind.metadata != nil {
+		return obj{ind.metadata, o.line, o.col}
+	}
+	if len(ind.objs) > 0 {
+		return ind.objs[len(ind.objs)-1]
+	}
+	return obj{nil, o.line, o.col}
+}
+
+// resolve_dict resolves `o` and returns its dictionary, the stream dictionary
+// for streams or nil.
+func (p *pdf) resolve_dict(o obj) obj_dict {
+	switch v := p.resolve(o).Type.(type) {
+	case obj_dict:
+		return v
+	case obj_ind:
+		return v.metadata
+	}
+	return nil
+}
+
+// resolve_array resolves `o` and its elements.
+func (p *pdf) resolve_array(o obj) obj_array {
+	array, ok := p.resolve(o).Type.(obj_array)
+	if !ok {
+		return nil
+	}
+	result := make(obj_array, len(array))
+	for i := range array {
+		result[i] = p.resolve(array[i])
+	}
+	return result
+}
+
+// resolve_number returns the value of a obj_int or obj_real, following references.
+func (p *pdf) resolve_number(o obj) (float64, bool) {
+	switch v := p.resolve(o).Type.(type) {
+	case obj_int:
+		return float64(v), true
+	case obj_real:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// trailer returns the trailer dictionary, either from the last xref table or
+// from the last cross-reference stream.
+func (p *pdf) trailer() obj_dict {
+	if p.src != nil {
+		return p.src.trailer
+	}
+	for i := len(p.objs) - 1; i >= 0; i-- {
+		switch v := p.objs[i].Type.(type) {
+		case obj_xref:
+			if v.enc != nil {
+				return v.enc
+			}
+		case obj_ind:
+			if v.metadata["Type"].Type == obj_named("XRef") {
+				return v.metadata
+			}
+		case obj_dict:
+			// a trailer without the xref table before it
+			if _, ok := v["Root"]; ok {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// catalog returns the document catalog, /Root in the trailer.
+func (p *pdf) catalog() obj_dict {
+	trailer := p.trailer()
+	if trailer != nil {
+		if root := p.resolve_dict(trailer["Root"]); root != nil {
+			return root
+		}
+	}
+	// No trailer(or a broken one), look for the catalog itself.
+	for _, o := range p.objs {
+		if ind, ok := o.Type.(obj_ind); ok && ind.metadata["Type"].Type == obj_named("Catalog") {
+			return ind.metadata
+		}
+	}
+	return nil
+}
+
+type page struct {
+	id        obj_int
+	dict      obj_dict
+	resources obj_dict  // /Resources, may be inherited from a parent /Pages node
+	media_box obj_array // /MediaBox, may be inherited from a parent /Pages node
+}
+
+// pages walks the page tree and returns the pages in order.
+func (p *pdf) pages() []page {
+	var result []page
+	catalog := p.catalog()
+	if catalog == nil {
+		return result
+	}
+	ref, _ := catalog["Pages"].Type.(obj_ref)
+	visited := map[obj_int]bool{}
+	var walk func(o obj, resources obj_dict, media_box obj_array)
+	walk = func(o obj, resources obj_dict, media_box obj_array) {
+		ref, ok := o.Type.(obj_ref)
+		if ok {
+			if visited[ref.id] {
+				return
+			}
+			visited[ref.id] = true
+		}
+		dict := p.resolve_dict(o)
+		if dict == nil {
+			return
+		}
+		if r := p.resolve_dict(dict["Resources"]); r != nil {
+			resources = r
+		}
+		if box := p.resolve_array(dict["MediaBox"]); len(box) == 4 {
+			media_box = box
+		}
+		if dict["Type"].Type == obj_named("Page") {
+			result = append(result, page{ref.id, dict, resources, media_box})
+			return
+		}
+		kids, _ := p.resolve(dict["Kids"]).Type.(obj_array)
+		for _, kid := range kids {
+			walk(kid, resources, media_box)
+		}
+	}
+	walk(obj{ref, 0, 0}, nil, nil)
+	return result
+}
+
+// page_contents returns the ids of the content streams of the page.
+func (p *pdf) page_contents(pg page) []obj_int {
+	var result []obj_int
+	o := pg.dict["Contents"]
+	if ref, ok := o.Type.(obj_ref); ok {
+		// /Contents may point to an array of streams
+		if ind, err := p.lookup(ref.id); err == nil && len(ind.objs) > 0 {
+			o = ind.objs[len(ind.objs)-1]
+		}
+	}
+	switch v := o.Type.(type) {
+	case obj_ref:
+		result = append(result, v.id)
+	case obj_array:
+		for _, o := range v {
+			if ref, ok := o.Type.(obj_ref); ok {
+				result = append(result, ref.id)
+			}
+		}
+	}
+	return result
+}
+
+// PageSizes returns the width and height of the /MediaBox of each page, in points.
+func (p pdf) PageSizes() [][2]float64 {
+	var result [][2]float64
+	for _, pg := range p.pages() {
+		var size [2]float64
+		if len(pg.media_box) == 4 {
+			size[0] = number(pg.media_box[2]) - number(pg.media_box[0])
+			size[1] = number(pg.media_box[3]) - number(pg.media_box[1])
+		}
+		result = append(result, size)
+	}
+	return result
+}
+
+// Fonts returns the /BaseFont of the fonts used by the pages, sorted and
+// without the prefix of subsets(ABCDEF+Helvetica is Helvetica).
+func (p pdf) Fonts() []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, pg := range p.pages() {
+		for _, o := range p.resolve_dict(pg.resources["Font"]) {
+			name, ok := p.resolve_dict(o)["BaseFont"].Type.(obj_named)
+			if !ok {
+				continue
+			}
+			s := string(name)
+			if i := strings.IndexByte(s, '+'); i == 6 {
+				s = s[i+1:]
+			}
+			if !seen[s] {
+				seen[s] = true
+				result = append(result, s)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// pdf_doc_encoding has the characters of PDFDocEncoding that are not the same as
+// in ISO Latin-1.
+var pdf_doc_encoding = map[byte]rune{
+	0x18: '\u02d8', 0x19: '\u02c7', 0x1a: '\u02c6', 0x1b: '\u02d9',
+	0x1c: '\u02dd', 0x1d: '\u02db', 0x1e: '\u02da', 0x1f: '\u02dc',
+	0x80: '\u2022', 0x81: '\u2020', 0x82: '\u2021', 0x83: '\u2026',
+	0x84: '\u2014', 0x85: '\u2013', 0x86: '\u0192', 0x87: '\u2044',
+	0x88: '\u2039', 0x89: '\u203a', 0x8a: '\u2212', 0x8b: '\u2030',
+	0x8c: '\u201e', 0x8d: '\u201c', 0x8e: '\u201d', 0x8f: '\u2018',
+	0x90: '\u2019', 0x91: '\u201a', 0x92: '\u2122', 0x93: '\ufb01',
+	0x94: '\ufb02', 0x95: '\u0141', 0x96: '\u0152', 0x97: '\u0160',
+	0x98: '\u0178', 0x99: '\u017d', 0x9a: '\u0131', 0x9b: '\u0142',
+	0x9c: '\u0153', 0x9d: '\u0161', 0x9e: '\u017e', 0xa0: '\u20ac',
+}
+
+// text_string decodes a text string(/ActualText, /Title, /Contents…), either
+// UTF-16BE or UTF-8 with a byte order mark or PDFDocEncoding.
+func text_string(s string) string {
+	switch {
+	case strings.HasPrefix(s, "\xfe\xff"):
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case strings.HasPrefix(s, "\xef\xbb\xbf"):
+		return s[3:]
+	}
+	var result strings.Builder
+	for i := 0; i < len(s); i++ {
+		if r, ok := pdf_doc_encoding[s[i]]; ok {
+			result.WriteRune(r)
+		} else {
+			result.WriteRune(rune(s[i]))
+		}
+	}
+	return result.String()
+}
+
+// resolve_text returns the text string `o`, following references.
+func (p *pdf) resolve_text(o obj) (string, bool) {
+	switch v := p.resolve(o).Type.(type) {
+	case obj_strl:
+		return text_string(string(v)), true
+	case obj_strh:
+		return text_string(string(v)), true
+	}
+	return "", false
+}
+
+// name_tree returns the keys and values of the name tree `o`, in order.
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf#page=88
+func (p *pdf) name_tree(o obj) ([]string, []obj) {
+	var keys []string
+	var values []obj
+	visited := map[obj_int]bool{}
+	var walk func(o obj)
+	walk = func(o obj) {
+		if ref, ok := o.Type.(obj_ref); ok {
+			if visited[ref.id] {
+				return
+			}
+			visited[ref.id] = true
+		}
+		node := p.resolve_dict(o)
+		if node == nil {
+			return
+		}
+		names, _ := p.resolve(node["Names"]).Type.(obj_array)
+		for i := 0; i+1 < len(names); i += 2 {
+			key, _ := p.resolve_text(names[i])
+			keys = append(keys, key)
+			values = append(values, names[i+1])
+		}
+		kids, _ := p.resolve(node["Kids"]).Type.(obj_array)
+		for _, kid := range kids {
+			walk(kid)
+		}
+	}
+	walk(o)
+	return keys, values
+}
@@ -8,8 +8,6 @@ import (
 
 type ColorSpace obj_named
 
-var cs ColorSpace
-
 const (
 	DeviceGray  ColorSpace = "DeviceGray"
 	CalGray     ColorSpace = "CalGray"
@@ -48,7 +46,7 @@ func (cp ColorSpace) String() string {
 //  Marked content         | MP, DP, BMC, BDC, EMC             | 584
 //  Compatibility          | BX, EX                            | 95
 
-func handle_operator(objs []obj, operator string, color_space obj_dict) ([]obj, error) {
+func handle_operator(objs []obj, operator string, color_space obj_dict, cs *ColorSpace) ([]obj, error) {
 	switch operator {
 	//  General graphics state | w, J, j, M, d, ri, i, gs          | 156
 	case "w", "J", "j", "M", "i":
@@ -124,23 +122,13 @@ func handle_operator(objs []obj, operator string, color_space obj_dict) ([]obj,
 					result += obj_str(val)
 				case obj_strh:
 					result += obj_str(val)
-				case obj_real:
-					if int(val) < -200 && int(val) > -450 {
-						result += " "
-					} else {
-						if int(val) < -500 {
-							objs = append(objs, obj{result, 0, 0})
-							result = ""
-						}
-					}
-				case obj_int:
-					if int(val) < -200 && int(val) > -450 {
+				case obj_real, obj_int:
+					space, split := tj_gap(o)
+					if space {
 						result += " "
-					} else {
-						if int(val) < -500 {
-							objs = append(objs, obj{result, 0, 0})
-							result = ""
-						}
+					} else if split {
+						objs = append(objs, obj{result, 0, 0})
+						result = ""
 					}
 				}
 			}
@@ -189,7 +177,7 @@ func handle_operator(objs []obj, operator string, color_space obj_dict) ([]obj,
 		color, ok := o.Type.(obj_named)
 		if ok {
 			var err error
-			cs, err = get_color_space(color, color_space)
+			*cs, err = get_color_space(color, color_space)
 			if err != nil {
 				fmt.Println(err)
 				return objs, err
@@ -199,7 +187,7 @@ func handle_operator(objs []obj, operator string, color_space obj_dict) ([]obj,
 		// NOTE(elias): need to keep track of the ColorSpace, since the amount os operands used
 		// byt the operator depends in things like the the current color space
 	case "SC", "sc":
-		switch cs {
+		switch *cs {
 		case DeviceGray, CalGray, Indexed:
 			objs, _ = Pop(objs)
 			return objs, nil
@@ -209,7 +197,7 @@ func handle_operator(objs []obj, operator string, color_space obj_dict) ([]obj,
 			return handle_seq_num(objs, 4, operator)
 		}
 	case "SCN", "scn":
-		switch cs {
+		switch *cs {
 		case DeviceGray, CalGray, Indexed:
 			objs, _ = Pop(objs)
 			return objs, nil
@@ -222,10 +210,10 @@ func handle_operator(objs []obj, operator string, color_space obj_dict) ([]obj,
 			return handle_seq_num(objs, 4, operator)
 		}
 	case "RG", "rg":
-		cs = DeviceRGB
+		*cs = DeviceRGB
 		return handle_seq_num(objs, 3, operator)
 	case "K", "k":
-		cs = DeviceCMYK
+		*cs = DeviceCMYK
 		return handle_seq_num(objs, 4, operator)
 
 	case "g", "G":
@@ -318,6 +306,19 @@ func get_color_space(color obj_named, color_space obj_dict) (ColorSpace, error)
 	return result, err
 }
 
+// tj_gap tells what the adjustment of a TJ array means for the text, a space
+// between words or a gap big enough to be another column.
+func tj_gap(o obj) (space, split bool) {
+	var n int
+	switch v := o.Type.(type) {
+	case obj_int:
+		n = int(v)
+	case obj_real:
+		n = int(v)
+	}
+	return n < -200 && n > -450, n < -500
+}
+
 // XXXX: Special graphics state | q, Q, cm                          | 156
 func handle_seq_num(objs []obj, total_count int, operator string) ([]obj, error) {
 	count := 0 // cm is a 6 element obj
@@ -0,0 +1,197 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Outline is an item of the document outline(bookmarks).
+type Outline struct {
+	Title string
+	Page  int // starting at 1, 0 when the destination is not a page of the document
+	Kids  []Outline
+	top   float64 // top of the destination in the page, NaN for the whole page
+}
+
+// destination returns the page number and top of the explicit or named
+// destination `o`.
+func (p *pdf) destination(o obj, page_numbers map[obj_int]int, named map[string]obj, depth int) (int, float64) {
+	if depth > 10 {
+		return 0, math.NaN()
+	}
+	switch v := p.resolve(o).Type.(type) {
+	case obj_strl, obj_strh, obj_named:
+		var name string
+		switch v := v.(type) {
+		case obj_strl:
+			name = text_string(string(v))
+		case obj_strh:
+			name = text_string(string(v))
+		case obj_named:
+			name = string(v)
+		}
+		if d, ok := named[name]; ok {
+			return p.destination(d, page_numbers, named, depth+1)
+		}
+	case obj_dict:
+		return p.destination(v["D"], page_numbers, named, depth+1)
+	case obj_array:
+		// [page /XYZ left top zoom], [page /FitH top], [page /FitR left bottom right top]…
+		if len(v) == 0 {
+			break
+		}
+		var page int
+		switch pg := v[0].Type.(type) {
+		case obj_ref:
+			page = page_numbers[pg.id]
+		case obj_int: // remote destinations use the page index
+			page = int(pg) + 1
+		}
+		top := math.NaN()
+		kind, _ := p.resolve(obj_array(v).get(1)).Type.(obj_named)
+		var t obj
+		switch kind {
+		case "XYZ":
+			t = obj_array(v).get(3)
+		case "FitH", "FitBH":
+			t = obj_array(v).get(2)
+		case "FitR":
+			t = obj_array(v).get(5)
+		}
+		if n, ok := p.resolve_number(t); ok {
+			top = n
+		}
+		return page, top
+	}
+	return 0, math.NaN()
+}
+
+// get returns the element `i` or an empty obj.
+func (a obj_array) get(i int) obj {
+	if i < len(a) {
+		return a[i]
+	}
+	return obj{}
+}
+
+func (p *pdf) outlines() []Outline {
+	catalog := p.catalog()
+	if catalog == nil {
+		return nil
+	}
+	root := p.resolve_dict(catalog["Outlines"])
+	if root == nil {
+		return nil
+	}
+	page_numbers := map[obj_int]int{}
+	for n, pg := range p.pages() {
+		page_numbers[pg.id] = n + 1
+	}
+	// named destinations, /Dests of the catalog(PDF 1.1) or the /Dests name tree
+	named := map[string]obj{}
+	for key, o := range p.resolve_dict(catalog["Dests"]) {
+		named[string(key)] = o
+	}
+	keys, values := p.name_tree(p.resolve_dict(catalog["Names"])["Dests"])
+	for i := range keys {
+		named[keys[i]] = values[i]
+	}
+
+	visited := map[obj_int]bool{}
+	var items func(o obj) []Outline
+	items = func(o obj) []Outline {
+		var result []Outline
+		for {
+			ref, ok := o.Type.(obj_ref)
+			if !ok || visited[ref.id] {
+				break
+			}
+			visited[ref.id] = true
+			dict := p.resolve_dict(o)
+			if dict == nil {
+				break
+			}
+			var item Outline
+			item.Title, _ = p.resolve_text(dict["Title"])
+			dest := dict["Dest"]
+			if action := p.resolve_dict(dict["A"]); action["S"].Type == obj_named("GoTo") {
+				dest = action["D"]
+			}
+			item.Page, item.top = p.destination(dest, page_numbers, named, 0)
+			item.Kids = items(dict["First"])
+			result = append(result, item)
+			o = dict["Next"]
+		}
+		return result
+	}
+	return items(root["First"])
+}
+
+// Bookmark returns the document with only the text and annotations under the
+// outline item `title`: from its destination to the one of the next item that
+// is not one of its kids.
+func (p pdf) Bookmark(title string) (pdf, error) {
+	type flat struct {
+		item  Outline
+		depth int
+	}
+	var items []flat
+	var walk func(outlines []Outline, depth int)
+	walk = func(outlines []Outline, depth int) {
+		for _, o := range outlines {
+			items = append(items, flat{o, depth})
+			walk(o.Kids, depth+1)
+		}
+	}
+	walk(p.Outlines, 0)
+	start := -1
+	for i := range items {
+		if items[i].item.Title == title {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return p, errors.New(fmt.Sprintf("bookmark `%s` not found", title))
+	}
+	if items[start].item.Page == 0 {
+		return p, errors.New(fmt.Sprintf("bookmark `%s` has no page destination", title))
+	}
+	from := items[start].item
+	to := Outline{Page: math.MaxInt32, top: math.NaN()}
+	for _, it := range items[start+1:] {
+		if it.depth <= items[start].depth && it.item.Page != 0 {
+			to = it.item
+			break
+		}
+	}
+
+	page_numbers := map[obj_int]int{}
+	for n, pg := range p.pages() {
+		page_numbers[pg.id] = n + 1
+	}
+	// reached reports if the position is at or after the destination
+	reached := func(dest Outline, page int, y float64) bool {
+		return page > dest.Page || (page == dest.Page && (math.IsNaN(dest.top) || y <= dest.top))
+	}
+	inside := func(page int, y float64) bool {
+		return page != 0 && reached(from, page, y) && !reached(to, page, y)
+	}
+
+	result := p
+	result.Text, result.text_pos = nil, nil
+	for i, pos := range p.text_pos {
+		if inside(page_numbers[pos.page], pos.y) {
+			result.Text = append(result.Text, p.Text[i])
+			result.text_pos = append(result.text_pos, pos)
+		}
+	}
+	result.Annotations = nil
+	for _, a := range p.Annotations {
+		if inside(a.Page, a.Rect[3]) {
+			result.Annotations = append(result.Annotations, a)
+		}
+	}
+	return result, nil
+}
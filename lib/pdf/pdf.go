@@ -2,11 +2,10 @@ package pdf
 
 import (
 	"bytes"
-	"compress/zlib"
 	"errors"
 	"fmt"
-	"io"
 	"log"
+	"runtime"
 	"strconv"
 	"strings"
 )
@@ -28,6 +27,11 @@ type obj_ind struct { // 5 0 obj\ncontent\nendobj
 	objs     []obj
 }
 type obj_str string
+type obj_text struct { // text shown by Tj, TJ, ' and " in a page
+	text string
+	page obj_int
+	x, y float64 // the position in the page where the text starts
+}
 type obj_strl string  // (Some string)
 type obj_strh string  // <2ca231fd1>
 type obj_named string // /NAME
@@ -55,6 +59,9 @@ type obj_bi struct {
 	data []byte
 }
 
+// Document is what Parse and ParseReaderAt return, to be named outside of the package.
+type Document = pdf
+
 type pdf struct {
 	ver struct {
 		major, minor int
@@ -64,6 +71,32 @@ type pdf struct {
 	objs        []obj
 	Text        []string
 	Resources   []obj_resources
+	fonts       map[obj_int]*font          // loaded fonts by obj id
+	mcids       map[obj_int]map[int]string // text of the marked content by page and MCID
+	Structure   []StructElement            // the structure tree of tagged PDFs
+	Fields      []Field                    // the fields of the form(/AcroForm)
+	Annotations []Annotation
+	Metadata    Metadata
+	Attachments []Attachment
+	Outlines    []Outline
+	text_pos    []obj_text // where each entry of Text is in the page, when known
+	src         *source    // where the objects are read from, see ParseReaderAt
+}
+
+// parse_ctx is what is needed to parse a content stream: the document it
+// belongs to and the resources of the page.
+type parse_ctx struct {
+	doc       *pdf
+	resources obj_dict
+	page      obj_int
+	font      *font // selected by the `Tf` operator
+	ctm       matrix
+	text      text_state
+	gstack    []graphics_state // saved by `q`
+	forms     []obj_int        // Form XObjects being interpreted, to detect cycles
+	marked    []marked_content // open BMC/BDC sequences
+	mcids     map[int]string   // text of the marked content by MCID, added to the page at the end
+	trace     *tracer          // nil unless the operators are traced, see Trace
 }
 
 type close_obj struct {
@@ -83,7 +116,7 @@ type obj_xref struct {
 	startxref obj_int
 }
 
-type obj_codechar uint32
+type obj_codechar uint64
 type obj_bfchar map[obj_codechar]obj_codechar
 type obj_bfrange struct {
 	start, end    obj_codechar
@@ -112,6 +145,8 @@ func typeStr(t obj) string {
 		return "obj_strl"
 	case obj_strh:
 		return "obj_strh"
+	case obj_text:
+		return "obj_text"
 	case obj_named:
 		return "obj_named"
 	case obj_pair:
@@ -144,94 +179,146 @@ func typeStr(t obj) string {
 	}
 }
 
-var delimiters = []byte{'(', ')', '<', '>', '[', ']', '{', '}', '/', '%', ' ', '\n', ''}
-
-func get_token(txt []byte, byte ...interface{}) (string, int) {
-	var pos int
-	size := len(txt)
-	txt = bytes.TrimLeft(txt, " \t\r")
-	pos = size - len(txt)
-	for i := range txt {
-		for _, d := range delimiters {
-			if txt[i] == d {
-				if i > 0 && txt[i-1] == '\\' {
-					break
-				}
-				if ((d == '<' && i+1 < len(txt) && txt[i+1] == '<') ||
-					(d == '>' && i+1 < len(txt) && txt[i+1] == '>')) && i == 0 {
-					// TODO(k0tto): check if there is a better way to do this
-					// if there isn't, then make proper checks.
-					i += 2
-				}
-				if i == 0 {
-					return string(txt[0]), pos + 1
-				}
-				return string(txt[0:i]), pos + i
+// read_strl returns the bytes of a literal string, `txt` starts after the `(`.
+// Balanced parentheses are part of the string, `\` escapes the next byte.
+// The second value is how many `(` were not closed.
+func read_strl(txt []byte) (obj_strl, int) {
+	to_balance := 1
+	for i := 0; i < len(txt); i++ {
+		switch txt[i] {
+		case '\\':
+			i++
+		case '(':
+			to_balance++
+		case ')':
+			to_balance--
+			if to_balance == 0 {
+				return obj_strl(txt[:i]), 0
 			}
 		}
 	}
-	return string(txt), size
+	return obj_strl(txt), to_balance
 }
 
-func read_strl(txt []byte) (obj_strl, int) {
-	to_balance := 1
-	for i := range txt {
-		if txt[i] == ')' {
-			if i-1 >= 0 && txt[i-1] == '\\' {
-				if i-2 >= 0 && txt[i-2] == '\\' {
-				} else {
-					continue
-				}
+// unescape_strl replaces the escape sequences of a literal string read by
+// read_strl: \n \r \t \b \f \( \) \\, octal \ddd and `\` followed by an end of
+// line, that continues the string in the next line. Other escaped chars are
+// kept without the `\`. An end of line not escaped is always a LF.
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf#page=23
+func unescape_strl(txt []byte) obj_strl {
+	result := make([]byte, 0, len(txt))
+	for i := 0; i < len(txt); i++ {
+		c := txt[i]
+		if c == '\r' {
+			if i+1 < len(txt) && txt[i+1] == '\n' {
+				i++
 			}
-			to_balance--
-			if i == 0 {
-				return obj_strl(""), to_balance
+			result = append(result, '\n')
+			continue
+		}
+		if c != '\\' {
+			result = append(result, c)
+			continue
+		}
+		i++
+		if i == len(txt) {
+			break
+		}
+		switch c = txt[i]; c {
+		case 'n':
+			result = append(result, '\n')
+		case 'r':
+			result = append(result, '\r')
+		case 't':
+			result = append(result, '\t')
+		case 'b':
+			result = append(result, '\b')
+		case 'f':
+			result = append(result, '\f')
+		case '\r':
+			if i+1 < len(txt) && txt[i+1] == '\n' {
+				i++
 			}
-			return obj_strl(txt[0:i]), to_balance
-		} else if txt[i] == '(' && i-1 >= 0 && txt[i-1] != '\\' {
-			to_balance++
+		case '\n':
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// up to 3 digits, the overflow of the high-order digit is ignored
+			var v byte
+			for j := 0; j < 3 && i < len(txt) && txt[i] >= '0' && txt[i] <= '7'; j++ {
+				v = v<<3 | (txt[i] - '0')
+				i++
+			}
+			i--
+			result = append(result, v)
+		default:
+			result = append(result, c)
 		}
 	}
-	return obj_strl(txt), to_balance
+	return obj_strl(result)
 }
 
 func read_strh(txt []byte) (string, error) {
 	for i := range txt {
 		if txt[i] == '>' {
-			if i == 0 {
-				return string(txt[0]), nil
-			}
 			return string(txt[0:i]), nil
 		}
 	}
 	return string(txt), errors.New("EOF")
 }
 
-func index_from_bread(lines []line, bread int) (int, error) {
-	for i := range lines {
-		if lines[i].end >= bread && lines[i].start <= bread {
-			return i, nil
+// decode_strh converts the bytes of a hexadecimal string to text when the font
+// is not known, using the CMaps in `resources`.
+func decode_strh(b []byte, resources []obj_resources) string {
+	var s strings.Builder
+	if len(resources) == 0 {
+		for _, c := range b {
+			s.WriteRune(rune(c))
 		}
+		return s.String()
 	}
-	return len(lines), errors.New(fmt.Sprintf("Read %d bytes, but last line ent at %d bytes\n", bread, lines[len(lines)-1].end))
+	// NOTE(elias): assuming character has 16bits
+	for i := 0; i+1 < len(b); i += 2 {
+		char := obj_codechar(b[i])<<8 | obj_codechar(b[i+1])
+		str := string(rune(char))
+		for _, res := range resources {
+			if _str, ok := res.to_unicode(char); ok {
+				str = _str
+				break
+			}
+		}
+		s.WriteString(str)
+	}
+	return s.String()
 }
 
+// in_dict reports if the next obj is part of a dictionary, as a value or inside
+// an array of one.
+func in_dict(c []close_obj) bool {
+	for i := range c {
+		if _, ok := c[i].obj.Type.(obj_dict); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveCloseObj returns the last open obj, an empty close_obj when there is
+// none.
 func RemoveCloseObj(c []close_obj) ([]close_obj, close_obj) {
 	n := len(c)
-	if n > 0 {
-		n--
-	} else {
-		log.Fatalf("ERROR: RemoveCloseObj len is 0\n")
+	if n == 0 {
+		return c, close_obj{}
 	}
-	o := c[n]
-	c = c[:n]
+	o := c[n-1]
+	c = c[:n-1]
 	return c, o
 }
 
+// Pop returns the last obj, an obj without Type when there is none: the
+// callers check the type of the operands they pop.
 func Pop(objs []obj) ([]obj, obj) {
 	m := len(objs)
 	if m == 0 {
-		log.Fatalln("ERROR: slice obj is len", m, "need to be >0")
+		return objs, obj{}
 	}
 	o := objs[m-1]
 	objs = objs[:m-1]
@@ -310,31 +397,9 @@ func get_obj_token_str(t obj, close bool) string {
 
 }
 
-type line struct {
-	index, start, end int
-}
-
-func AppendLine(lines []line, start, end int) []line {
-	m := len(lines)
-	if m == cap(lines) {
-		newlines := make([]line, m, (m+1)*2)
-		copy(newlines, lines)
-		lines = newlines
-	}
-	var index int
-	if m > 0 {
-		index = lines[m-1].index
-	} else {
-		index = 0
-	}
-	lines = lines[:m+1]
-	lines[m] = line{index + 1, start, end}
-	return lines
-}
-
 func get_endstream(txt []byte) (int, error) {
 	i := 0
-	for i < len(txt)-9 {
+	for i <= len(txt)-9 {
 		if txt[i] == 'e' &&
 			txt[i+1] == 'n' &&
 			txt[i+2] == 'd' &&
@@ -351,20 +416,23 @@ func get_endstream(txt []byte) (int, error) {
 	return 0, errors.New("Coulds not find `endstream`")
 }
 
-func read_until_EI(txt []byte) (int, error) {
-	i := 0
-	for i < len(txt)-3 {
-		if txt[i] == 'E' &&
-			txt[i+1] == 'I' &&
-			(txt[i+2] == ' ' || txt[i+2] == '\n' || txt[i-2] == '\t' || txt[i-2] == '\r') {
-			return i, nil
-		}
-		i++
-	}
-	return 0, errors.New("Coulds not find `endstream`")
+// needs_open are the tokens that close or take their operands from the last
+// open obj.
+var needs_open = map[string]bool{
+	">>": true, "]": true, "R": true, "obj": true, "endobj": true, "stream": true,
+	"def": true, "pop": true, "begin": true, "end": true,
+	"beginbfchar": true, "beginbfrange": true, "begincodespacerange": true,
+	"endbfchar": true, "endbfrange": true, "endcodespacerange": true,
 }
 
 func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, error) {
+	return parse(doc, color_space, resources, nil)
+}
+
+// parse_objs reads the objects of `doc`. The streams that still need to be
+// parsed(content streams, object streams, CMaps) are returned by their index in
+// result.objs.
+func parse_objs(doc []byte, color_space obj_dict, resources []obj_resources, ctx *parse_ctx) (pdf, []obj_int, error) {
 	var obj_to_close []close_obj
 	var result pdf
 	result.color_space = color_space
@@ -374,85 +442,53 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 		metadata map[obj_named]obj
 	},
 		0, 10)
-	var start, end int
-	var lines []line
-	for end > -1 {
-		var tend int
-		tend = bytes.IndexByte(doc[start:], '\n')
-		if tend == -1 {
-			end = len(doc[start:]) + start
-		} else {
-			end = tend + start
-		}
-		lines = AppendLine(lines, start, end)
-		start = end + 1
-		end = tend
-	}
+	lex := new_lexer(doc)
 
 	var to_parse []obj_int // objs that have the streams to be parsed.
 	dict_begin := false    // for CID resources dict begin
-	bread := 0
-	line_index := 0
-	for line_index < len(lines) {
-		col := 0
-		line := doc[lines[line_index].start:lines[line_index].end]
-		for col < len(line) {
-			token, pos := get_token(line[col:])
-			before_token_len := pos - len(token)
-			col += before_token_len
-			if len(token) == 0 {
-				continue
-			}
+	for {
+		token, ok := lex.next()
+		if !ok {
+			break
+		}
+		if needs_open[token] && len(obj_to_close) == 0 {
+			return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d unexpected `%s`\n", lex.tok_line, lex.tok_col, token))
+		}
+		{
 			var objc obj
 			var closed_obj obj
 			{
 				switch token {
 				case "%":
 					// % defines a commemt and it goes to the end of the line
-					header := []byte("%PDF-") //Ex: %PDF-1.7
-					if line_index == 0 && bytes.HasPrefix(doc[:len(header)], header) {
-						bread = len(header)
-						ver_ := bytes.TrimSpace(doc[bread:lines[line_index].end])
-						ver := bytes.Split(ver_, []byte("."))
+					start := lex.pos
+					comment := lex.read_comment()
+					header := "PDF-" //Ex: %PDF-1.7
+					if start == 1 && strings.HasPrefix(comment, header) {
+						ver := strings.Split(strings.TrimSpace(comment[len(header):]), ".")
 						if len(ver) != 2 {
-							return result, errors.New(fmt.Sprintf("ERROR:%d:%d: Failed to parse PDF version from `%v` is not a valid version `m.n`\n", line_index+1, len(header), doc[line_index]))
+							return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d: Failed to parse PDF version from `%v` is not a valid version `m.n`\n", lex.tok_line, len(header)+1, comment))
 						}
-						i, err := strconv.ParseInt(string(ver[0]), 10, 32)
+						i, err := strconv.ParseInt(ver[0], 10, 32)
 						if err != nil {
-							return result, errors.New(fmt.Sprintf("ERROR:%d:%d: Failed to parse PDF version `%v` is not an integer\n", line_index+1, len(header), ver[0]))
+							return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d: Failed to parse PDF version `%v` is not an integer\n", lex.tok_line, len(header)+1, ver[0]))
 						}
 						result.ver.major = int(i)
-						i, err = strconv.ParseInt(string(ver[1]), 10, 32)
+						i, err = strconv.ParseInt(ver[1], 10, 32)
 						if err != nil {
-							return result, errors.New(fmt.Sprintf("ERROR:%d:%d: Failed to parse PDF version `%v` is not an integer\n", line_index+1, len(header)+len(ver[0])+1, ver[1]))
+							return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d: Failed to parse PDF version `%v` is not an integer\n", lex.tok_line, len(header)+len(ver[0])+2, ver[1]))
 						}
 						result.ver.minor = int(i)
-						bread = lines[0].end + 1
-
-						line := doc[lines[line_index+1].start:lines[line_index+1].end]
-						if '%' == line[0] &&
-							line[1] > 128 &&
-							line[2] > 128 &&
-							line[3] > 128 {
-							// "PDF has binary content."
-							bread += len(line)
-							bread++
-							line_index++
-						}
-						col = len(doc[lines[0].start:lines[0].end])
+						continue
+					}
+					if len(comment) >= 3 && comment[0] > 128 && comment[1] > 128 && comment[2] > 128 {
+						// "PDF has binary content."
 						continue
 					}
 
-					if line[col+1] == '%' &&
-						line[col+2] == 'E' &&
-						line[col+3] == 'O' &&
-						line[col+4] == 'F' {
-						col++
-						bread++
-						token = string(line[col:])
-						objc = obj{obj_eof("EOF"), line_index + 1, col + 1 + before_token_len}
+					if strings.HasPrefix(comment, "%EOF") {
+						objc = obj{obj_eof("EOF"), lex.tok_line, lex.tok_col}
 						closed_obj = objc
-						col = len(line)
 
 						if len(obj_to_close) == 1 {
 							o_xref := obj_to_close[0].obj
@@ -464,7 +500,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 								o_xref.Type, err = handle_xref(oc.childs)
 								result.objs = append(result.objs, o_xref)
 								if !ok {
-									return result, errors.New(fmt.Sprintf("ERROR: expected interger, found %s\n!", err))
+									return result, to_parse, errors.New(fmt.Sprintf("ERROR: expected interger, found %s\n!", err))
 								}
 
 							} else {
@@ -476,24 +512,16 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 							}
 						}
 					} else {
-						col++
-						bread++
-						token = string(line[col:])
-						objc = obj{obj_comment(token), line_index + 1, col + before_token_len}
+						objc = obj{obj_comment(comment), lex.tok_line, lex.tok_col}
 						closed_obj = objc
 					}
 				case "(":
 					//- strings []u8. Empty strings is valid:
 					//  (liteal) may contem new lines,(),*,!,&,^,%,\),\\…\ddd(octal up to 3 digit)
-					col++
-					strl, balance := read_strl(doc[lines[line_index].start+col:])
-					token = string(strl)
-					token_ := strings.ReplaceAll(token, "\\(", "(")
-					token_ = strings.ReplaceAll(token_, "\\)", ")")
-					token_ = strings.ReplaceAll(token_, "\\\\", "\\")
-					o := obj{obj_strl(token_), line_index + 1, col + 1 + before_token_len}
+					strl, balance := lex.read_strl()
+					o := obj{unescape_strl([]byte(strl)), lex.tok_line, lex.tok_col}
 					if balance > 0 {
-						return result, errors.New(fmt.Sprintf("ERROR:%d:%d expected token `)`, found EOF\n", o.line, o.col))
+						return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d expected token `)`, found EOF\n", o.line, o.col))
 					}
 					if len(obj_to_close) > 0 {
 						obj_to_close = AppendChild(obj_to_close, o)
@@ -501,17 +529,17 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 						result.objs = append(result.objs, o)
 					}
 				case ")":
-					objc = obj{obj_strl(""), line_index + 1, col + 1 + before_token_len}
+					objc = obj{obj_strl(""), lex.tok_line, lex.tok_col}
 				case "<<":
 					//- <<…>> denotes a dictionary like
 					//  <</Type /Example >>
-					o := obj{obj_dict{}, line_index + 1, col + 1 + before_token_len}
+					o := obj{obj_dict{}, lex.tok_line, lex.tok_col}
 					obj_to_close = append(obj_to_close, close_obj{o, nil})
 				case ">>":
 					o := obj_to_close[len(obj_to_close)-1].obj
 					dict, ok := o.Type.(obj_dict)
 					if !ok {
-						log.Fatalf("+ERROR:%d:%d Expected `%v`, found `>>`.\n", o.line, o.col, typeStr(o))
+						return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d expected %s, found `>>`\n", lex.tok_line, lex.tok_col, typeStr(o)))
 					}
 					var oc close_obj
 					obj_to_close, oc = RemoveCloseObj(obj_to_close)
@@ -533,9 +561,11 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 								ref, ok := childs[i+1].Type.(obj_ref)
 								if ok {
 									is_font_metadata = true
-									fontfile = fontfile[:len(fontfile)+1]
-									fontfile[len(fontfile)-1].id = ref.id
-									fontfile[len(fontfile)-1].mod_id = ref.mod_id
+									fontfile = append(fontfile, struct {
+										id       obj_int
+										mod_id   obj_int
+										metadata map[obj_named]obj
+									}{id: ref.id, mod_id: ref.mod_id})
 								}
 							}
 							dict[key] = childs[i+1]
@@ -552,110 +582,45 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					closed_obj = obj{dict, oc.obj.line, oc.obj.col}
 				case "<":
 					//  <hexadecimal string> ex <ab901f> if missing a digit ex<ab1>, <ab10> is assumed.
-					o := obj{obj_strh(""), line_index + 1, col + 1 + before_token_len}
-					col++
+					o := obj{obj_strh(""), lex.tok_line, lex.tok_col}
 					var err error
-					token, err = read_strh(doc[lines[line_index].start+col:])
+					token, err = lex.read_strh()
 					if err != nil {
-						log.Println(string(doc))
-						log.Fatalf("ERROR:%d:%d expected token `>`, found EOF\n", o.line, o.col)
+						return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d expected token `>`, found EOF\n", o.line, o.col))
 					}
 					var oj obj
 					if len(obj_to_close) > 0 {
 						oj = obj_to_close[len(obj_to_close)-1].obj
 					}
+					if _, ok := oj.Type.(obj_array); ok && len(obj_to_close) > 1 {
+						// bfrange destination array: <0000> <0002> [<0041> <0042> <0043>]
+						oj = obj_to_close[len(obj_to_close)-2].obj
+					}
 					switch oj.Type {
 					case "beginbfchar", "beginbfrange", "begincodespacerange":
-						val, err := strconv.ParseUint(token, 16, 32)
+						val, err := strconv.ParseUint(strings.Join(strings.Fields(token), ""), 16, 64)
 						if err != nil {
-							log.Printf("ERRO:%d:%d Cound not Parse `%s` in hexadecimal codepoint.\n", line_index+1, col+1, token)
+							log.Printf("ERRO:%d:%d Cound not Parse `%s` in hexadecimal codepoint.\n", lex.tok_line, lex.tok_col, token)
 						}
-						obj_to_close = AppendChild(obj_to_close, obj{obj_codechar(val), line_index + 1, col + 1})
+						obj_to_close = AppendChild(obj_to_close, obj{obj_codechar(val), lex.tok_line, lex.tok_col})
 					default:
-						strh := token
-						size := len(strh)
-						if len(resources) == 0 {
-							if size%2 != 0 {
-								strh = strh + "0"
-								size++
-							}
-							size = size / 2
-							shex := make([]uint64, size)
-							for i := range shex {
-								it := i * 2
-								var err error
-								shex[i], err = strconv.ParseUint(strh[it:it+2], 16, 0)
-								if err != nil {
-									log.Printf("ERRO:%d:%d Cound not Parse `%s` in hexadecimal string: %s\n", line_index+1, col+1+i, strh[it:it+1], strh)
-								}
-							}
-							s := make([]string, len(shex))
-							for i := range shex {
-								s[i] = fmt.Sprintf("%c", shex[i])
-							}
-							fstr := strings.Join(s, "")
-							o.Type = obj_strh(fstr)
-							closed_obj = o
-						} else { // use the resources for the encoding
-							// NOTE(elias): assuming character has 16bits
-							size = size / 4
-							shex := make([]int64, 0, size)
-							for it := 0; it < len(strh); it += 4 {
-								char, err := strconv.ParseInt(strh[it:it+4], 16, 32)
-								if err != nil {
-									log.Printf("ERRO:%d:%d Cound not Parse `%s` in hexadecimal string: %s\n", line_index+1, col+1+it, strh[it:it+1], strh)
-								}
-								found := false
-								for _, res := range resources {
-									if c, ok := res.CodeSpace.bfchars[obj_codechar(char)]; ok {
-										char = int64(c)
-										found = true
-										break
-									}
-								}
-								if !found {
-									for _, res := range resources {
-										for i := range res.CodeSpace.bfranges {
-											if int64(res.CodeSpace.bfranges[i].start) <= char && char <= int64(res.CodeSpace.bfranges[i].end) {
-												if len(res.CodeSpace.bfranges[i].dest_array) > 0 {
-													fmt.Println("So… this PDF is using bgrangs array. I don't know how to handle that yet.")
-													char += int64(res.CodeSpace.bfranges[i].dest_array[0])
-												} else {
-													char += int64(res.CodeSpace.bfranges[i].dest_codechar)
-												}
-												found = true
-												break
-											}
-										}
-									}
-								}
-								if char&0xffff0000 == 0 {
-									shex = append(shex, char)
-								} else {
-									shex = append(shex, char>>16)
-									shex = append(shex, char&0x0000ffff)
-								}
-							}
-							s := make([]string, len(shex))
-							for i := range shex {
-								s[i] = string(rune(shex[i]))
-							}
-							fstr := strings.Join(s, "")
-							o.Type = obj_strh(fstr)
-							closed_obj = o
+						if in_dict(obj_to_close) || ctx != nil {
+							// keep the bytes, strings inside dictionaries are text strings and the
+							// strings of a page are decoded with the font when shown.
+							o.Type = obj_strh(hex_decode(token))
+						} else {
+							o.Type = obj_strh(decode_strh(hex_decode(token), resources))
 						}
+						closed_obj = o
 					}
-					col++
 				case ">":
-					objc = obj{obj_strh(""), line_index + 1, col + 1 + before_token_len}
+					objc = obj{obj_strh(""), lex.tok_line, lex.tok_col}
 				case "/":
 					//- named objects start with the prefix / with no white spaces or delimiters
 					//  they are case sensitive… /Name1 /other /@this /$$ /1.2 /aa;dd_ss**a? /.notdef are valid.
-					// TODO(k0tto): Need to handle the use of characters in hex as `/GF#3A`
-					//  PDF>1.2 /#13asd is valid(hexadecimal of invalid character)
-					col++
-					token, pos = get_token(line[col:])
-					obj_to_close = AppendChild(obj_to_close, obj{obj_named(token), line_index + 1, col + 1 + before_token_len})
+					//  PDF>1.2 /GF#3A is valid(hexadecimal of a character), read_name decodes it.
+					token = lex.read_name()
+					obj_to_close = AppendChild(obj_to_close, obj{obj_named(token), lex.tok_line, lex.tok_col})
 				case "R":
 					childs, mod_id := Pop(obj_to_close[len(obj_to_close)-1].childs)
 					childs, id := Pop(childs)
@@ -666,25 +631,25 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					if !ok1 || !ok2 {
 						log.Printf("ERROR: token not an integer: id: [%T] mod: [%T]", id.Type, mod_id.Type)
 					}
-					objc = obj{obj_ref{id_val, mod_id_val}, line_index + 1, col + 1 + before_token_len}
+					objc = obj{obj_ref{id_val, mod_id_val}, lex.tok_line, lex.tok_col}
 					closed_obj = objc
 				case "[":
 					//- [] denotes an array like [32 12.5 false (txt) /this]
-					o := obj{obj_array{}, line_index + 1, col + 1 + before_token_len}
+					o := obj{obj_array{}, lex.tok_line, lex.tok_col}
 					obj_to_close = append(obj_to_close, close_obj{o, nil})
 				case "]":
-					objc = obj{obj_array{}, line_index + 1, col + 1 + before_token_len}
+					objc = obj{obj_array{}, lex.tok_line, lex.tok_col}
 					oc := obj_to_close[len(obj_to_close)-1]
 					o, ok := oc.obj.Type.(obj_array)
 					if !ok {
-						log.Fatalf("ERROR: objc: %T, obj_to_close[last]: %T\n", objc.Type, oc.obj.Type)
+						return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d expected %s, found `]`\n", lex.tok_line, lex.tok_col, typeStr(oc.obj)))
 					}
 					obj_to_close, oc = RemoveCloseObj(obj_to_close)
 					childs := oc.childs
 					for _, c := range childs {
 						o = append(o, c)
 					}
-					closed_obj = obj{o, oc.obj.line + 1, oc.obj.col + 1 + before_token_len}
+					closed_obj = obj{o, oc.obj.line, oc.obj.col}
 				case "obj":
 					//- any obj that may or maynot be refered by any obj_ref
 					childs, mod_id := Pop(obj_to_close[len(obj_to_close)-1].childs)
@@ -699,14 +664,14 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					if !ok1 || !ok2 {
 						log.Print("ERROR: token not an integer: 1", ok1, "2", ok2)
 					}
-					o := obj{obj_ind{id: id_val, mod_id: mod_id_val, objs: nil}, line_index + 1, col + 1 + before_token_len}
+					o := obj{obj_ind{id: id_val, mod_id: mod_id_val, objs: nil}, lex.tok_line, lex.tok_col}
 					obj_to_close = append(obj_to_close, close_obj{o, nil})
 				case "endobj":
-					objc = obj{obj_ind{}, line_index + 1, col + 1 + before_token_len}
+					objc = obj{obj_ind{}, lex.tok_line, lex.tok_col}
 					oc := obj_to_close[len(obj_to_close)-1]
 					ind, ok := oc.obj.Type.(obj_ind)
 					if !ok {
-						log.Fatalf("ERROR:%d:%d found `endobj`, expected %s\n", line_index+1, col+1, typeStr(oc.obj))
+						return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d found `endobj`, expected %s\n", lex.tok_line, lex.tok_col, typeStr(oc.obj)))
 					}
 					obj_to_close, oc = RemoveCloseObj(obj_to_close)
 					childs := oc.childs
@@ -731,39 +696,39 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					o_ind := obj_to_close[len(obj_to_close)-1].obj
 					ind, ok_ind := o_ind.Type.(obj_ind)
 					var stream_decoded []byte
-					// Assume the stream data start in a new line.
-					line_index++
-					end_stream, _ := get_endstream(doc[lines[line_index].start:])
 					var stream_encoded []byte
-					if doc[lines[line_index].start+end_stream-1] == '\n' {
-						end_stream--
+					var metadata obj_dict
+					if childs := obj_to_close[len(obj_to_close)-1].childs; len(childs) > 0 {
+						metadata, _ = childs[len(childs)-1].Type.(obj_dict)
+					}
+					length := -1
+					if l, ok := metadata["Length"].Type.(obj_int); ok {
+						length = int(l)
 					}
+					data := lex.read_stream(length)
 					if ok_ind {
-						if end_stream > 0 {
-							childs := obj_to_close[len(obj_to_close)-1].childs
-							o_dict := childs[len(childs)-1]
-							metadata, ok := o_dict.Type.(obj_dict)
+						if len(data) > 0 {
+							ok := metadata != nil
 							_, ok_stype := metadata[obj_named("Subtype")].Type.(obj_named)
-							//NOTE(elias): assuming that the content stream metadata
-							// does not contain Type or Subtype fields.
-							if ok && !ok_stype {
+							if ok {
 								o_filter := metadata[obj_named("Filter")]
 								if o_filter.Type != nil {
-									stream_encoded = doc[lines[line_index].start : lines[line_index].start+end_stream]
+									stream_encoded = data
 								} else {
-									stream_decoded = doc[lines[line_index].start : lines[line_index].start+end_stream]
+									stream_decoded = data
 								}
+							}
+							//NOTE(elias): assuming that the content stream metadata
+							// does not contain Type or Subtype fields.
+							// Font programs(FontFile, FontFile2) are the only streams with /Length1.
+							_, ok_length1 := metadata[obj_named("Length1")]
+							is_file := metadata["Type"].Type == obj_named("EmbeddedFile")
+							if ok && !ok_stype && !ok_length1 && !is_file {
 								to_parse = append(to_parse, obj_int(len(result.objs))) // index of the stream I need to decode.
 							}
 						}
 					}
-					o := obj{obj_stream{encoded_content: stream_encoded, decoded_content: stream_decoded, objs: nil}, line_index + 1, col + 1 + before_token_len}
-
-					var err error
-					line_index, err = index_from_bread(lines, lines[line_index].start+end_stream)
-					if err != nil {
-						log.Println(err)
-					}
+					o := obj{obj_stream{encoded_content: stream_encoded, decoded_content: stream_decoded, objs: nil}, lex.tok_line, lex.tok_col}
 					obj_to_close = AppendChild(obj_to_close, o)
 					// NOTE(elias): start using the metadata/stream fields in the struct
 					if ok_ind {
@@ -777,7 +742,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					if !ok {
 						_str := fmt.Sprintf("Expected %s, found `def`\n", typeStr(obj_to_close[len(obj_to_close)-1].obj))
 						log.Printf(_str)
-						return result, errors.New(_str)
+						return result, to_parse, errors.New(_str)
 					}
 
 					childs, o_value := Pop(obj_to_close[len(obj_to_close)-1].childs)
@@ -792,26 +757,26 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 						dict, ok := o_value.Type.(obj_dict)
 						if !ok {
 							log.Print("ERROR:def dict token not a dict: ", o_value)
-							return result, errors.New("ERROR:def dict token not a dict: ")
+							return result, to_parse, errors.New("ERROR:def dict token not a dict: ")
 						}
 						cspacerange.CIDSystemInfo = dict
 					case "CMapName":
 						str, ok := o_value.Type.(obj_named)
 						if !ok {
 							log.Print("ERROR:def dict token not a obj_named")
-							return result, errors.New("ERROR:def dict token not a obj_named")
+							return result, to_parse, errors.New("ERROR:def dict token not a obj_named")
 						}
 						cspacerange.CMapName = str
 					case "CMapType":
 						i, ok := o_value.Type.(obj_int)
 						if !ok {
 							log.Print("ERROR:def dict token not a obj_int")
-							return result, errors.New("ERROR:def dict token not a obj_int")
+							return result, to_parse, errors.New("ERROR:def dict token not a obj_int")
 						}
 						cspacerange.CMapType = i
 					default:
 						log.Printf("ERROR:def token unkown %s\n", key)
-						return result, errors.New("ERROR:def token unkown")
+						return result, to_parse, errors.New("ERROR:def token unkown")
 					}
 				case "pop":
 					//TODO(elias): find out what this should be doing exactly.
@@ -822,24 +787,24 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					childs, o_cmapname := Pop(childs)
 					if defineresource, ok := o_defineresource.Type.(string); !ok || defineresource != "defineresource" {
 						log.Printf("ERROR:pop expected defineresource, found %v\n", o_defineresource)
-						return result, errors.New("ERROR:def token unkown")
+						return result, to_parse, errors.New("ERROR:def token unkown")
 					}
 					if cmap, ok := o_cmap.Type.(obj_named); !ok || cmap != "CMap" {
 						log.Printf("ERROR:pop expected CMap, found %v\n", o_cmap)
-						return result, errors.New("ERROR:def token unkown")
+						return result, to_parse, errors.New("ERROR:def token unkown")
 					}
 					if currentdict, ok := o_current.Type.(string); !ok || currentdict != "currentdict" {
 						log.Printf("ERROR:pop expected currentdict, found %v\n", o_current)
-						return result, errors.New("ERROR:def token unkown")
+						return result, to_parse, errors.New("ERROR:def token unkown")
 					}
 					if cmapname, ok := o_cmapname.Type.(string); !ok || cmapname != "CMapName" {
 						log.Printf("ERROR:pop not defineresource %v\n", o_defineresource)
-						return result, errors.New("ERROR:def token unkown")
+						return result, to_parse, errors.New("ERROR:def token unkown")
 					}
 					obj_to_close[len(obj_to_close)-1].childs = childs
 				case "beginbfchar", "beginbfrange", "begincodespacerange":
 					obj_to_close[len(obj_to_close)-1].childs, _ = Pop(obj_to_close[len(obj_to_close)-1].childs)
-					obj_to_close = append(obj_to_close, close_obj{obj{token, line_index + 1, col + 1}, nil})
+					obj_to_close = append(obj_to_close, close_obj{obj{token, lex.tok_line, lex.tok_col}, nil})
 				case "begin":
 					childs, o_res := Pop(obj_to_close[len(obj_to_close)-1].childs)
 					key, ok := o_res.Type.(string)
@@ -854,7 +819,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 						_, ok := o_value.Type.(obj_int) // there is no use for this for now?
 						if ok {
 							log.Print("ERROR:begin dict dict token not an obj_int")
-							return result, errors.New("ERROR:def dict token not an obj_int")
+							return result, to_parse, errors.New("ERROR:def dict token not an obj_int")
 						}
 						dict_begin = true
 					case "findresource":
@@ -864,17 +829,17 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 						_, ok := o_named2.Type.(obj_named) // there is no use for this for now?
 						if !ok {
 							log.Print("ERROR:begin findresource token not a obj_named")
-							return result, errors.New("ERROR:dbegin findresource token not a obj_named")
+							return result, to_parse, errors.New("ERROR:dbegin findresource token not a obj_named")
 						}
 						_, ok = o_named1.Type.(obj_named) // there is no use for this for now?
 						if !ok {
 							log.Print("ERROR:begin findresource  token not a obj_named")
-							return result, errors.New("ERROR:begin findresource token not a obj_named")
+							return result, to_parse, errors.New("ERROR:begin findresource token not a obj_named")
 						}
-						obj_to_close = append(obj_to_close, close_obj{obj{obj_resources{}, line_index + 1, col + 1}, nil})
+						obj_to_close = append(obj_to_close, close_obj{obj{obj_resources{}, lex.tok_line, lex.tok_col}, nil})
 					default:
 						log.Printf("ERROR:begin token unkown %s\n", key)
-						return result, errors.New("ERROR:begin findresource token not a obj_named")
+						return result, to_parse, errors.New("ERROR:begin findresource token not a obj_named")
 					}
 				case "endcmap", "begincmap":
 				case "end":
@@ -883,7 +848,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 						obj_to_close, oc = RemoveCloseObj(obj_to_close)
 						resource, ok := oc.obj.Type.(obj_resources)
 						if !ok {
-							log.Panicln("Not REsources!")
+							return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d found `end`, expected %s\n", lex.tok_line, lex.tok_col, typeStr(oc.obj)))
 						}
 						result.Resources = append(result.Resources, resource)
 					}
@@ -893,7 +858,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					if !ok || endbfchar != "beginbfrange" {
 						_str := fmt.Sprintf("Expected %s(%v), found `endbfrange`\n", typeStr(obj_to_close[len(obj_to_close)-1].obj), obj_to_close[len(obj_to_close)-1].obj)
 						log.Printf(_str)
-						return result, errors.New(_str)
+						return result, to_parse, errors.New(_str)
 					}
 					var oc close_obj
 					obj_to_close, oc = RemoveCloseObj(obj_to_close)
@@ -902,9 +867,9 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					if len(childs)%3 != 0 {
 						_str := fmt.Sprintf("bfchar should olnly contain a three pdf obj of char codepoints\n%v\n", childs)
 						log.Printf(_str)
-						return result, errors.New(_str)
+						return result, to_parse, errors.New(_str)
 					}
-					bfranges := make([]obj_bfrange, len(childs)/3)
+					bfranges := make([]obj_bfrange, 0, len(childs)/3)
 
 					for len(childs) > 0 {
 						var o_bfchar1, o_bfchar2, o_bfchar3 obj
@@ -915,7 +880,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 						bfchar1, ok1 := o_bfchar1.Type.(obj_codechar)
 						bfchar2, ok2 := o_bfchar2.Type.(obj_codechar)
 						if !ok1 || !ok2 {
-							log.Panicln("ERROR: token not an codechar: 1", ok1, o_bfchar1, o_bfchar2)
+							return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d expected the codes of a bfrange, found %s and %s\n", o_bfchar1.line, o_bfchar1.col, typeStr(o_bfchar1), typeStr(o_bfchar2)))
 						}
 						bfranges = append(bfranges, obj_bfrange{start: bfchar1, end: bfchar2})
 						switch v := o_bfchar3.Type.(type) {
@@ -928,15 +893,23 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 								}
 							}
 						default:
-							log.Panicf("Failend to match the obj for %v, in the bfrange\n", o_bfchar3.Type)
+							return result, to_parse, errors.New(fmt.Sprintf("ERROR:%d:%d expected a code or an array in the bfrange, found %s\n", o_bfchar3.line, o_bfchar3.col, typeStr(o_bfchar3)))
 						}
 					}
+					cspacerange, ok := obj_to_close[len(obj_to_close)-1].obj.Type.(obj_resources)
+					if !ok {
+						_str := fmt.Sprintf("Expected %s, found `endbfrange`\n", typeStr(obj_to_close[len(obj_to_close)-1].obj))
+						log.Printf(_str)
+						return result, to_parse, errors.New(_str)
+					}
+					cspacerange.CodeSpace.bfranges = append(cspacerange.CodeSpace.bfranges, bfranges...)
+					obj_to_close[len(obj_to_close)-1].obj.Type = cspacerange
 				case "endbfchar":
 					endbfchar, ok := obj_to_close[len(obj_to_close)-1].obj.Type.(string)
 					if !ok || endbfchar != "beginbfchar" {
 						_str := fmt.Sprintf("Expected %s(%v), found `endbfchar`\n", typeStr(obj_to_close[len(obj_to_close)-1].obj), obj_to_close[len(obj_to_close)-1].obj)
 						log.Printf(_str)
-						return result, errors.New(_str)
+						return result, to_parse, errors.New(_str)
 					}
 
 					var oc close_obj
@@ -945,7 +918,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					if len(childs)%2 != 0 {
 						_str := fmt.Sprintf("bfchar should olnly contain a key value sequence of char codepoints\n%v\n", childs)
 						log.Printf(_str)
-						return result, errors.New(_str)
+						return result, to_parse, errors.New(_str)
 					}
 
 					bfchars := make(obj_bfchar, len(childs)/2)
@@ -965,16 +938,22 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					if !ok {
 						_str := fmt.Sprintf("Expected %s, found `endconge`\n", typeStr(obj_to_close[len(obj_to_close)-1].obj))
 						log.Printf(_str)
-						return result, errors.New(_str)
+						return result, to_parse, errors.New(_str)
+					}
+					// a CMap may have more than one bfchar block
+					if cspacerange.CodeSpace.bfchars == nil {
+						cspacerange.CodeSpace.bfchars = obj_bfchar{}
+					}
+					for k, v := range bfchars {
+						cspacerange.CodeSpace.bfchars[k] = v
 					}
-					cspacerange.CodeSpace.bfchars = bfchars
 					obj_to_close[len(obj_to_close)-1].obj.Type = cspacerange
 				case "endcodespacerange":
 					endcoderange, ok := obj_to_close[len(obj_to_close)-1].obj.Type.(string)
 					if !ok || endcoderange != "begincodespacerange" {
 						_str := fmt.Sprintf("Expected %s(%v), found `endcodespacerange`\n", typeStr(obj_to_close[len(obj_to_close)-1].obj), obj_to_close[len(obj_to_close)-1].obj)
 						log.Printf(_str)
-						return result, errors.New(_str)
+						return result, to_parse, errors.New(_str)
 					}
 					var oc close_obj
 					obj_to_close, oc = RemoveCloseObj(obj_to_close)
@@ -989,29 +968,29 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 						log.Println("ERROR: token not an named: 1", ok1)
 						log.Println(o_crange1)
 						log.Println(o_crange2)
-						return result, errors.New("ERROR: token not an named: 1")
+						return result, to_parse, errors.New("ERROR: token not an named: 1")
 					}
 
 					cspacerange, ok := obj_to_close[len(obj_to_close)-1].obj.Type.(obj_resources)
 					if !ok {
 						_str := fmt.Sprintf("Expected %s, found `endcoderange`\n", typeStr(obj_to_close[len(obj_to_close)-1].obj))
 						log.Printf(_str)
-						return result, errors.New(_str)
+						return result, to_parse, errors.New(_str)
 					}
 					cspacerange.CodeSpace.codespacerange[0] = crange1
 					cspacerange.CodeSpace.codespacerange[1] = crange2
 					obj_to_close[len(obj_to_close)-1].obj.Type = cspacerange
 				case "false":
 					//- boolean false
-					obj_to_close = AppendChild(obj_to_close, obj{obj_bool(false), line_index + 1, col + 1 + before_token_len})
+					obj_to_close = AppendChild(obj_to_close, obj{obj_bool(false), lex.tok_line, lex.tok_col})
 				case "true":
 					//- boolean true
-					obj_to_close = AppendChild(obj_to_close, obj{obj_bool(true), line_index + 1, col + 1 + before_token_len})
+					obj_to_close = AppendChild(obj_to_close, obj{obj_bool(true), lex.tok_line, lex.tok_col})
 				case "null":
 					//- null obj
-					obj_to_close = AppendChild(obj_to_close, obj{obj_null(nil), line_index + 1, col + 1 + before_token_len})
+					obj_to_close = AppendChild(obj_to_close, obj{obj_null(nil), lex.tok_line, lex.tok_col})
 				case "xref":
-					obj_to_close = append(obj_to_close, close_obj{obj{obj_xref{}, line_index + 1, col + 1 + before_token_len}, nil})
+					obj_to_close = append(obj_to_close, close_obj{obj{obj_xref{}, lex.tok_line, lex.tok_col}, nil})
 				case "trailer", "startxref":
 					// PDF operators
 					// for more information look at lib/pdf/operator.go
@@ -1032,19 +1011,21 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					"d0", "d1",
 					"CS", "cs", "SC", "SCN", "sc", "scn", "G", "g", "RG", "rg", "K", "k",
 					"sh":
+					if len(obj_to_close) == 0 && ctx != nil {
+						// operators without operands(BT, q) may be the first token of the page
+						obj_to_close = append(obj_to_close, close_obj{obj{nil, 0, 0}, nil})
+					}
 					if len(obj_to_close) > 0 {
-						childs := obj_to_close[len(obj_to_close)-1].childs
 						var err error
-						childs, err = handle_operator(childs, token, result.color_space)
-						obj_to_close[len(obj_to_close)-1].childs = childs
+						obj_to_close[len(obj_to_close)-1].childs, err = ctx.operator(token, obj_to_close[len(obj_to_close)-1].childs, result.color_space, &result.cs)
 						if err != nil {
-							return result, err
+							return result, to_parse, err
 						}
 					}
 				case "f", "n":
 					_, ok := obj_to_close[len(obj_to_close)-1].obj.Type.(obj_xref)
 					if ok {
-						obj_to_close = AppendChild(obj_to_close, obj{token, line_index + 1, col + 1 + before_token_len})
+						obj_to_close = AppendChild(obj_to_close, obj{token, lex.tok_line, lex.tok_col})
 						break
 					}
 				case "BI":
@@ -1055,16 +1036,9 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					if len(obj_to_close) > 0 {
 						_, ok := obj_to_close[len(obj_to_close)-1].obj.Type.(obj_bi)
 						if ok {
-							ei, _ := read_until_EI(doc[lines[line_index].start+col:])
-							var err error
-							line_index, err = index_from_bread(lines, lines[line_index].start+ei)
-							if err != nil {
-								log.Println(err)
-								return result, err
-							}
+							lex.read_inline_image()
 						}
 					}
-					col = len(line)
 					obj_to_close, _ = RemoveCloseObj(obj_to_close)
 					continue
 				case "EI":
@@ -1075,7 +1049,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 					{
 						num_int, err := strconv.ParseInt(token, 10, 0)
 						if err == nil {
-							obj_num := obj{obj_int(num_int), line_index + 1, col + 1 + before_token_len}
+							obj_num := obj{obj_int(num_int), lex.tok_line, lex.tok_col}
 							obj_to_close = AppendChild(obj_to_close, obj_num)
 							break
 						}
@@ -1083,7 +1057,7 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 						if err != nil {
 							num_float, err := strconv.ParseFloat(token, 0)
 							if err == nil {
-								obj_num := obj{obj_real(num_float), line_index + 1, col + 1 + before_token_len}
+								obj_num := obj{obj_real(num_float), lex.tok_line, lex.tok_col}
 								obj_to_close = AppendChild(obj_to_close, obj_num)
 								break
 							}
@@ -1093,16 +1067,12 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 								// NOTE(elias): when there is a resource stream, those streing show up.
 								// add everything and check latter what it is.
 								// case "beginbfchar", "beginbfrange", "begincoderange", "findresource", "CMapName", "currentdict", "defineresource", "dict":
-								obj_to_close = AppendChild(obj_to_close, obj{token, line_index + 1, col + 1})
+								obj_to_close = AppendChild(obj_to_close, obj{token, lex.tok_line, lex.tok_col})
 							}
 						}
 					}
 				}
 			}
-			col += len(token)
-			if col > len(line) {
-				col = len(line)
-			}
 			if closed_obj.Type != nil {
 				if len(obj_to_close) > 0 {
 					obj_to_close = AppendChild(obj_to_close, closed_obj)
@@ -1111,12 +1081,10 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 				}
 			}
 		}
-		bread += col + 1
-		line_index++
 	}
 	if len(obj_to_close) > 0 {
 		if result.ver.major != 0 {
-			return result, errors.New(fmt.Sprintf("%%%%EOF found, expected token %v\n", get_obj_token_str(obj_to_close[len(obj_to_close)-1].obj, true)))
+			return result, to_parse, errors.New(fmt.Sprintf("%%%%EOF found, expected token %v\n", get_obj_token_str(obj_to_close[len(obj_to_close)-1].obj, true)))
 		} else {
 			result.objs = append(result.objs, obj_to_close[0].childs...)
 		}
@@ -1134,103 +1102,127 @@ func Parse(doc []byte, color_space obj_dict, resources []obj_resources) (pdf, er
 			}
 		}
 	}
+	return result, to_parse, nil
+}
+
+// parse does the work of Parse, `ctx` is given when parsing the content stream
+// of a page so the text can be decoded with the page fonts.
+func parse(doc []byte, color_space obj_dict, resources []obj_resources, ctx *parse_ctx) (pdf, error) {
+	result, to_parse, err := parse_objs(doc, color_space, resources, ctx)
+	if err != nil {
+		return result, err
+	}
 
 	//find resources
 	if len(to_parse) > 0 {
-		var index int
-		for index < len(to_parse) {
-			i := to_parse[index]
-			o_ind := result.objs[i]
-			ind, ok := o_ind.Type.(obj_ind)
-			if ok {
-				dict := ind.metadata
-				ref, ok_length := dict["Length"].Type.(obj_ref)
-				var length int
-				if !ok_length {
-					length = len(ind.stream.encoded_content)
-					if length == 0 {
-						length = len(ind.stream.decoded_content)
-					}
-					ok_length = true
-				} else {
-					o_ind_length, err := get_obj_by_id(result.objs, ref.id)
-					if err != nil {
-						log.Fatalf("failed to get id for delayed stream decode length id: %v\n", ind)
-					}
-					ind_length, _ := o_ind_length.Type.(obj_ind)
-					length_, ok_ := ind_length.objs[len(ind_length.objs)-1].Type.(obj_int)
-					ok_length = ok_
-					length = int(length_)
-				}
-				var Type string
-				t, _ok := ind.metadata["Type"].Type.(obj_named)
-				if _ok {
-					Type = string(t)
-				}
-				if ok_length && len(ind.stream.decoded_content) == 0 {
-					if len(ind.stream.encoded_content) > 0 && Type != "Metadata" {
-						str := ind.stream.encoded_content
-						if int(length) != len(str) {
-							log.Fatalln("failed to get id for delayed stream decode; length mismatch")
-						}
-						r, err := zlib.NewReader(bytes.NewReader(str))
-						if err != nil {
-							return result, errors.New(fmt.Sprintf("failled to decode stream of obj %d:%d %v", ind.id, ind.mod_id, err))
-						}
-						ind.stream.decoded_content, err = io.ReadAll(r)
-						if err != nil {
-							return result, errors.New(fmt.Sprintf("failled to readall:%d: %v", line_index+1, err))
-						}
-					}
-					result.objs[i].Type = ind
-				}
-				{
-					if len(Type) < 0 || (Type != "FontDescriptor" && Type != "Metadata" && Type != "XRef" && !strings.HasPrefix(Type, "FontFile")) {
-						_pdf, err := Parse(ind.stream.decoded_content, result.color_space, result.Resources)
+		// Object streams hold the pages and fonts, and CMaps are needed to decode
+		// the text of the streams without a font. They are parsed first, then the
+		// content streams are parsed in parallel.
+		var objstms, others []obj_int
+		for _, i := range to_parse {
+			ind, ok := result.objs[i].Type.(obj_ind)
+			if !ok {
+				continue
+			}
+			Type, _ := ind.metadata["Type"].Type.(obj_named)
+			switch {
+			case Type == "ObjStm":
+				objstms = append(objstms, i)
+			case Type != "FontDescriptor" && Type != "Metadata" && Type != "XRef" && !strings.HasPrefix(string(Type), "FontFile"):
+				others = append(others, i)
+			}
+		}
+		var jobs []stream_job
+		for _, i := range objstms {
+			jobs = append(jobs, stream_job{index: i})
+		}
+		if err := result.parse_streams(jobs, 1); err != nil {
+			return result, err
+		}
 
-						if err != nil && err.Error() != "SKIP" {
-							log.Printf("%s", err)
-							return result, err
-						}
-						ind.stream.objs = _pdf.objs
-						result.objs[i].Type = ind
-						if len(_pdf.Resources) > 0 {
-							for _, r := range _pdf.Resources {
-								result.Resources = append(result.Resources, r)
-							}
-							newindex := make([]obj_int, len(to_parse)-1)
-							copy(newindex, to_parse[:index])
-							copy(newindex[index:], to_parse[index+1:])
-							to_parse = newindex
-							index = 0
-							continue
-						}
-					}
-				}
+		content_page := map[obj_int]page{} // content stream id to the page it belongs
+		for _, pg := range result.pages() {
+			for _, id := range result.page_contents(pg) {
+				content_page[id] = pg
+			}
+		}
+		var cmaps []stream_job
+		jobs = nil
+		for _, i := range others {
+			ind := result.objs[i].Type.(obj_ind)
+			if pg, ok := content_page[ind.id]; ok {
+				jobs = append(jobs, stream_job{i, new_parse_ctx(&result, pg.id, pg.resources)})
+				continue
+			}
+			ind, err := result.decode_delayed(ind)
+			if err != nil {
+				return result, err
+			}
+			result.objs[i].Type = ind
+			if bytes.Contains(ind.stream.decoded_content, []byte("begincmap")) {
+				cmaps = append(cmaps, stream_job{index: i})
+			} else {
+				jobs = append(jobs, stream_job{index: i})
 			}
-			index++
 		}
+		if err := result.parse_streams(cmaps, 1); err != nil {
+			return result, err
+		}
+		result.load_fonts()
+		if err := result.parse_streams(jobs, runtime.NumCPU()); err != nil {
+			return result, err
+		}
+
 		for _, o := range result.objs {
-			if ind, ok := o.Type.(obj_ind); ok {
-				for _, _o := range ind.stream.objs {
-					switch t := _o.Type.(type) {
-					case obj_str:
-						result.Text = append(result.Text, strings.TrimSpace(string(t)))
-					case obj_strl:
-						result.Text = append(result.Text, strings.TrimSpace(string(t)))
-					case obj_strh:
-						result.Text = append(result.Text, strings.TrimSpace(string(t)))
-					case obj_int, obj_real:
-					default:
-					}
-				}
+			if ind, ok := o.Type.(obj_ind); ok && !is_objstm(o) {
+				result.add_text(ind.stream.objs)
 			}
 		}
 	}
+	if result.ver.major != 0 {
+		result.document()
+	}
 
 	return result, nil
 }
 
+// add_text appends the text left by the content stream in `objs` to Text.
+func (p *pdf) add_text(objs []obj) {
+	for _, o := range objs {
+		var text obj_text
+		switch t := o.Type.(type) {
+		case obj_str:
+			text.text = string(t)
+		case obj_strl:
+			text.text = string(t)
+		case obj_strh:
+			text.text = string(t)
+		case obj_text:
+			text = t
+		default:
+			continue
+		}
+		p.Text = append(p.Text, strings.TrimSpace(text.text))
+		p.text_pos = append(p.text_pos, text)
+	}
+}
+
+// document reads what is outside the pages: the structure tree, the form, the
+// annotations…
+func (p *pdf) document() {
+	p.Structure = p.structure()
+	p.Fields = p.fields()
+	p.Annotations = p.annotations()
+	p.Metadata = p.metadata()
+	p.Attachments = p.attachments()
+	p.Outlines = p.outlines()
+}
+
+func is_objstm(o obj) bool {
+	ind, ok := o.Type.(obj_ind)
+	return ok && ind.metadata["Type"].Type == obj_named("ObjStm")
+}
+
 func get_obj(objs []obj, o string) (obj, error) {
 	for _, _o := range objs {
 		if typeStr(_o) == o {
@@ -1,10 +1,16 @@
 package pdf
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 // func TestHelloName(t *testing.T) {
@@ -638,3 +644,758 @@ startxref
 		t.Fail()
 	}
 }
+
+// build_pdf writes a document with the objects `objs`, numbered from 1, the
+// first one is the catalog.
+func build_pdf(objs ...string) string {
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	for i, o := range objs {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	b.WriteString("trailer\n<</Root 1 0 R>>\n%%EOF")
+	return b.String()
+}
+
+func stream_obj(dict, content string) string {
+	return fmt.Sprintf("<<%s/Length %d>>\nstream\n%s\nendstream", dict, len(content), content)
+}
+
+func TestFormXObject(t *testing.T) {
+	log.SetPrefix("TestFormXObject: ")
+	str := build_pdf(
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Resources<</XObject<</Fm1 5 0 R/Im1 7 0 R>>>>/Contents 4 0 R>>",
+		stream_obj("", "BT (Before) Tj ET q 2 0 0 2 0 10 cm /Im1 Do /Fm1 Do Q BT (After) Tj ET"),
+		stream_obj("/Type/XObject/Subtype/Form/BBox[0 0 100 100]/Matrix[1 0 0 1 10 0]/Resources<</XObject<</Fm2 6 0 R>>>>",
+			"BT (Footer) Tj ET /Fm2 Do"),
+		// Fm2 paints Fm1 again, it should be interpreted only once.
+		stream_obj("/Type/XObject/Subtype/Form/BBox[0 0 100 100]/Resources<</XObject<</Fm1 5 0 R>>>>",
+			"BT (Inner) Tj ET /Fm1 Do"),
+		stream_obj("/Type/XObject/Subtype/Image/Width 1/Height 1/ColorSpace/DeviceGray/BitsPerComponent 8", "0"),
+	)
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	expected := []string{"Before", "Footer", "Inner", "After"}
+	if strings.Join(pdf.Text, "|") != strings.Join(expected, "|") {
+		log.Printf("expected %q, found %q\n", expected, pdf.Text)
+		t.Fail()
+	}
+
+	// the form is painted with its /Matrix then the CTM at the `Do`: Footer is
+	// at (0, 0) of the form, moved by 10 then scaled by 2 and moved up by 10.
+	if len(pdf.text_pos) != len(expected) {
+		log.Printf("expected the positions of %q, found %v\n", expected, pdf.text_pos)
+		t.FailNow()
+	}
+	for i, xy := range [][2]float64{{0, 0}, {20, 10}, {20, 10}, {0, 0}} {
+		if pos := pdf.text_pos[i]; pos.x != xy[0] || pos.y != xy[1] {
+			log.Printf("expected `%s` at %v, found (%v, %v)\n", pos.text, xy, pos.x, pos.y)
+			t.Fail()
+		}
+	}
+}
+
+func TestMarkedContent(t *testing.T) {
+	log.SetPrefix("TestMarkedContent: ")
+	content := `/P <</MCID 4>> BDC BT /Span <</ActualText <FEFF00660069006e>>> BDC (X) Tj EMC ET EMC
+/TD <</MCID 0>> BDC BT (Name) Tj ET EMC
+/TD <</MCID 1>> BDC BT (Total) Tj ET EMC
+/Artifact BMC BT (Page 1) Tj ET EMC
+/TD <</MCID 2>> BDC BT (Ana) Tj ET EMC
+/Cell /MC3 BDC BT (10,00) Tj ET EMC
+/Figure <</Alt (A chart)>> BDC 0 0 10 10 re f EMC`
+	str := build_pdf(
+		"<</Type/Catalog/Pages 2 0 R/StructTreeRoot 5 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Resources<</Properties<</MC3<</MCID 3>>>>>>/Contents 4 0 R>>",
+		stream_obj("", content),
+		"<</Type/StructTreeRoot/K 6 0 R/RoleMap<</Cell/TD>>>>",
+		"<</S/Document/P 5 0 R/Pg 3 0 R/K[7 0 R 8 0 R]>>",
+		"<</S/P/K 4>>",
+		"<</S/Table/K[9 0 R 10 0 R]>>",
+		"<</S/TR/K[<</S/TD/K 0>> <</S/TD/K 1>>]>>",
+		"<</S/TR/K[<</S/TD/K 2>> <</S/Cell/K<</Type/MCR/MCID 3>>>>]>>",
+	)
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	expected := []string{"fin", "Name", "Total", "Page 1", "Ana", "10,00", "A chart"}
+	if strings.Join(pdf.Text, "|") != strings.Join(expected, "|") {
+		log.Printf("expected %q, found %q\n", expected, pdf.Text)
+		t.Fail()
+	}
+	if len(pdf.Structure) != 1 || pdf.Structure[0].Type != "Document" || pdf.Structure[0].Text != "fin Name Total Ana 10,00" {
+		log.Printf("unexpected structure %v\n", pdf.Structure)
+		t.FailNow()
+	}
+	tables := pdf.Structure[0].Find("Table")
+	if len(tables) != 1 {
+		log.Printf("expected a table, found %v\n", tables)
+		t.FailNow()
+	}
+	rows := fmt.Sprint(tables[0].Table())
+	if rows != "[[Name Total] [Ana 10,00]]" {
+		log.Printf("unexpected table %s\n", rows)
+		t.Fail()
+	}
+}
+
+func TestFields(t *testing.T) {
+	log.SetPrefix("TestFields: ")
+	str := build_pdf(
+		"<</Type/Catalog/Pages 2 0 R/AcroForm<</Fields[5 0 R 6 0 R 9 0 R 10 0 R 11 0 R 13 0 R]>>>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Contents 4 0 R/Annots[5 0 R 12 0 R]>>",
+		stream_obj("", "BT (Form) Tj ET"),
+		"<</FT/Tx/T(name)/V(Ana Maria)/Type/Annot/Subtype/Widget/Rect[0 0 100 10]>>",
+		"<</FT/Tx/T(address)/Kids[7 0 R 8 0 R]>>",
+		"<</T(city)/V<FEFF005300E3006F>/Parent 6 0 R>>",
+		"<</T(zip)/V(01000)/Parent 6 0 R>>",
+		"<</FT/Btn/T(agree)/Kids[12 0 R]>>",
+		"<</FT/Ch/T(state)/V(SP)/Opt[[(SP)(Sao Paulo)] [(RJ)(Rio de Janeiro)]]>>",
+		"<</FT/Btn/Ff 65536/T(submit)>>",
+		"<</Type/Annot/Subtype/Widget/Parent 9 0 R/AS/Yes/Rect[0 20 10 30]>>",
+		"<</FT/Btn/Ff 32768/T(color)/V/1/Opt[(red) (blue)]>>",
+	)
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	expected := []Field{
+		{"name", "Tx", "Ana Maria"},
+		{"address.city", "Tx", "São"},
+		{"address.zip", "Tx", "01000"},
+		{"agree", "Btn", "Yes"},
+		{"state", "Ch", "Sao Paulo"},
+		{"color", "Btn", "blue"},
+	}
+	if fmt.Sprint(pdf.Fields) != fmt.Sprint(expected) {
+		log.Printf("expected %v, found %v\n", expected, pdf.Fields)
+		t.Fail()
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	log.SetPrefix("TestAnnotations: ")
+	content := "BT /F1 12 Tf 72 700 Td (Statement) Tj 0 -100 Td (Total) Tj ET"
+	str := build_pdf(
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Contents 4 0 R/Annots[5 0 R 6 0 R 7 0 R 8 0 R]>>",
+		stream_obj("", content),
+		"<</Type/Annot/Subtype/FreeText/Rect[300 660 72 640]/Contents(Paid on 05/10)>>",
+		"<</Type/Annot/Subtype/Link/Rect[72 700 150 712]/A<</S/URI/URI(https://example.com/)>>>>",
+		"<</Type/Annot/Subtype/Text/Rect[10 10 20 20]/Contents(Check this)/Popup 8 0 R>>",
+		"<</Type/Annot/Subtype/Popup/Rect[20 20 120 80]/Parent 7 0 R>>",
+	)
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	expected := []Annotation{
+		{1, "FreeText", [4]float64{72, 640, 300, 660}, "Paid on 05/10", "", 3},
+		{1, "Link", [4]float64{72, 700, 150, 712}, "", "https://example.com/", 3},
+		{1, "Text", [4]float64{10, 10, 20, 20}, "Check this", "", 3},
+		{1, "Popup", [4]float64{20, 20, 120, 80}, "Check this", "", 3},
+	}
+	if fmt.Sprint(pdf.Annotations) != fmt.Sprint(expected) {
+		log.Printf("expected %v, found %v\n", expected, pdf.Annotations)
+		t.Fail()
+	}
+	text := pdf.TextWithAnnotations()
+	if strings.Join(text, "|") != "Statement|Paid on 05/10|Total" {
+		log.Printf("unexpected text %q\n", text)
+		t.Fail()
+	}
+	if strings.Join(pdf.Text, "|") != "Statement|Total" {
+		log.Printf("unexpected text %q\n", pdf.Text)
+		t.Fail()
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	log.SetPrefix("TestParseDate: ")
+	for s, expected := range map[string]time.Time{
+		"D:20211028112318+02'00'": time.Date(2021, 10, 28, 11, 23, 18, 0, time.FixedZone("", 2*3600)),
+		"D:20211028112318-03'30":  time.Date(2021, 10, 28, 11, 23, 18, 0, time.FixedZone("", -(3*3600+30*60))),
+		"D:20211028112318Z":       time.Date(2021, 10, 28, 11, 23, 18, 0, time.UTC),
+		"D:202110":                time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+		"20211028":                time.Date(2021, 10, 28, 0, 0, 0, 0, time.UTC),
+	} {
+		date, err := parse_date(s)
+		if err != nil || !date.Equal(expected) {
+			log.Printf("`%s`: expected %v, found %v %v\n", s, expected, date, err)
+			t.Fail()
+		}
+	}
+	if _, err := parse_date("D:"); err == nil {
+		log.Println("expected an error for an empty date")
+		t.Fail()
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	log.SetPrefix("TestMetadata: ")
+	xmp := `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" pdf:Producer="Statement Engine 2.1"/>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Statement</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>Ana</rdf:li><rdf:li>Bia</rdf:li></rdf:Seq></dc:creator>
+<xmp:CreateDate>2023-05-10T08:30:00-03:00</xmp:CreateDate>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+	str := build_pdf(
+		"<</Type/Catalog/Pages 2 0 R/Metadata 4 0 R>>",
+		"<</Type/Pages/Kids[]/Count 0>>",
+		"<</Title(Extrato)/ModDate(D:2023051109)>>",
+		stream_obj("/Type/Metadata/Subtype/XML", xmp),
+	)
+	str = strings.Replace(str, "<</Root 1 0 R>>", "<</Root 1 0 R/Info 3 0 R>>", 1)
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	m := pdf.Metadata
+	if m.Title != "Extrato" || m.Author != "Ana, Bia" || m.Producer != "Statement Engine 2.1" || m.XMP["dc:title"] != "Statement" {
+		log.Printf("unexpected metadata %v\n", m)
+		t.Fail()
+	}
+	if !m.CreationDate.Equal(time.Date(2023, 5, 10, 11, 30, 0, 0, time.UTC)) || !m.ModDate.Equal(time.Date(2023, 5, 11, 9, 0, 0, 0, time.UTC)) {
+		log.Printf("unexpected dates %v %v\n", m.CreationDate, m.ModDate)
+		t.Fail()
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	log.SetPrefix("TestAttachments: ")
+	csv := "date;description;value\n2023-05-10;Market;-10,00\n"
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte(csv))
+	w.Close()
+	str := build_pdf(
+		"<</Type/Catalog/Pages 2 0 R/Names<</EmbeddedFiles 5 0 R>>>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Contents 4 0 R/Annots[9 0 R 10 0 R 12 0 R]>>",
+		stream_obj("", "BT (Statement) Tj ET"),
+		"<</Kids[6 0 R]>>",
+		"<</Names[(statement.csv) 7 0 R]/Limits[(statement.csv) (statement.csv)]>>",
+		"<</Type/Filespec/F(statement.csv)/EF<</F 8 0 R>>/Desc(The statement as CSV)>>",
+		stream_obj("/Type/EmbeddedFile/Filter[/ASCIIHexDecode/FlateDecode]", hex.EncodeToString(compressed.Bytes())+">"),
+		"<</Type/Annot/Subtype/FileAttachment/Rect[0 0 10 10]/FS 7 0 R>>",
+		"<</Type/Annot/Subtype/FileAttachment/Rect[0 0 10 10]/Contents(Receipt)/FS<</F(../receipt.txt)/EF<</F 11 0 R>>>>>>",
+		stream_obj("/Type/EmbeddedFile", "paid"),
+		"<</Type/Annot/Subtype/FileAttachment/Rect[0 0 10 10]/FS<</F(broken.bin)/EF<</F 13 0 R>>>>>>",
+		stream_obj("/Type/EmbeddedFile/Filter/FlateDecode", "not zlib"),
+	)
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if len(pdf.Attachments) != 3 {
+		log.Printf("expected 3 attachments, found %v\n", pdf.Attachments)
+		t.FailNow()
+	}
+	a := pdf.Attachments[0]
+	data, err := pdf.AttachmentData(a)
+	if a.Name != "statement.csv" || a.Description != "The statement as CSV" || a.Page != 0 || string(data) != csv || err != nil {
+		log.Printf("unexpected attachment %v %q %v\n", a, data, err)
+		t.Fail()
+	}
+	a = pdf.Attachments[1]
+	data, err = pdf.AttachmentData(a)
+	if a.Name != "../receipt.txt" || a.Description != "Receipt" || a.Page != 1 || string(data) != "paid" || err != nil {
+		log.Printf("unexpected attachment %v %q %v\n", a, data, err)
+		t.Fail()
+	}
+	// the data is only decoded when asked, a broken one doesn't hide the attachment
+	a = pdf.Attachments[2]
+	if _, err := pdf.AttachmentData(a); a.Name != "broken.bin" || err == nil {
+		log.Printf("expected an error for the data of %v\n", a)
+		t.Fail()
+	}
+	if strings.Join(pdf.Text, "|") != "Statement" {
+		log.Printf("the attachments should not be in the text %q\n", pdf.Text)
+		t.Fail()
+	}
+}
+
+func TestOutlines(t *testing.T) {
+	log.SetPrefix("TestOutlines: ")
+	str := build_pdf(
+		"<</Type/Catalog/Pages 2 0 R/Outlines 9 0 R/Names<</Dests<</Names[(acc2) 14 0 R]>>>>>>",
+		"<</Type/Pages/Kids[3 0 R 4 0 R 5 0 R]/Count 3>>",
+		"<</Type/Page/Parent 2 0 R/Contents 6 0 R>>",
+		"<</Type/Page/Parent 2 0 R/Contents 7 0 R>>",
+		"<</Type/Page/Parent 2 0 R/Contents 8 0 R/Annots[<</Subtype/FreeText/Rect[10 500 100 520]/Contents(Note)>>]>>",
+		stream_obj("", "BT 72 780 Td (Account 1) Tj 0 -80 Td (A1 item) Tj ET"),
+		stream_obj("", "BT 72 700 Td (A1 item2) Tj 0 -310 Td (Account 2) Tj 0 -90 Td (A2 item) Tj ET"),
+		stream_obj("", "BT 72 700 Td (A2 item3) Tj ET"),
+		"<</Type/Outlines/First 10 0 R/Last 11 0 R/Count 3>>",
+		"<</Title(Account 1)/Parent 9 0 R/Next 11 0 R/First 12 0 R/Last 12 0 R/Dest[3 0 R/XYZ 0 800 0]>>",
+		"<</Title(Account 2)/Parent 9 0 R/Prev 10 0 R/Dest(acc2)>>",
+		"<</Title(Transactions)/Parent 10 0 R/A<</S/GoTo/D[3 0 R/Fit]>>>>",
+		"null",
+		"<</D[4 0 R/XYZ 0 400 null]>>",
+	)
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	o := pdf.Outlines
+	if len(o) != 2 || o[0].Title != "Account 1" || o[0].Page != 1 || len(o[0].Kids) != 1 ||
+		o[0].Kids[0].Title != "Transactions" || o[0].Kids[0].Page != 1 ||
+		o[1].Title != "Account 2" || o[1].Page != 2 || o[1].top != 400 {
+		log.Printf("unexpected outlines %v\n", o)
+		t.FailNow()
+	}
+	for title, expected := range map[string]string{
+		"Account 1":    "Account 1|A1 item|A1 item2",
+		"Account 2":    "Account 2|A2 item|A2 item3|Note",
+		"Transactions": "Account 1|A1 item|A1 item2",
+	} {
+		scoped, err := pdf.Bookmark(title)
+		if err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		if text := strings.Join(scoped.TextWithAnnotations(), "|"); text != expected {
+			log.Printf("`%s`: expected `%s`, found `%s`\n", title, expected, text)
+			t.Fail()
+		}
+	}
+	if _, err := pdf.Bookmark("Account 3"); err == nil || err.Error() != "bookmark `Account 3` not found" {
+		log.Printf("expected an error for a missing bookmark, found %v\n", err)
+		t.Fail()
+	}
+
+	// the named destination of the bookmark is missing
+	str = build_pdf(
+		"<</Type/Catalog/Pages 2 0 R/Outlines 5 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Contents 4 0 R>>",
+		stream_obj("", "BT 72 780 Td (Account 1) Tj ET"),
+		"<</Type/Outlines/First 6 0 R/Last 6 0 R/Count 1>>",
+		"<</Title(Account 1)/Parent 5 0 R/Dest(missing)>>",
+	)
+	pdf, err = Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if len(pdf.Outlines) != 1 || pdf.Outlines[0].Page != 0 {
+		log.Printf("unexpected outlines %v\n", pdf.Outlines)
+		t.FailNow()
+	}
+	if _, err := pdf.Bookmark("Account 1"); err == nil || err.Error() != "bookmark `Account 1` has no page destination" {
+		log.Printf("expected an error for a bookmark without page, found %v\n", err)
+		t.Fail()
+	}
+}
+
+// build_pdf_xref is build_pdf with a xref table, `update` objects are added
+// after it as an incremental update with its own xref section.
+func build_pdf_xref(objs []string, update map[int]string) string {
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f\r\n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<</Size %d/Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	if len(update) == 0 {
+		return b.String()
+	}
+	offsets = offsets[:0]
+	var ids []int
+	for id := range update {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", id, update[id])
+	}
+	prev := xref
+	xref = b.Len()
+	b.WriteString("xref\n")
+	for i, id := range ids {
+		fmt.Fprintf(&b, "%d 1\n%010d 00000 n\r\n", id, offsets[i])
+	}
+	fmt.Fprintf(&b, "trailer\n<</Size %d/Root 1 0 R/Prev %d>>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, prev, xref)
+	return b.String()
+}
+
+func TestParseReaderAt(t *testing.T) {
+	log.SetPrefix("TestParseReaderAt: ")
+	file, err := ioutil.ReadFile("../../sample/pdf_example.pdf")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	expected, err := Parse(file, nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	// the object stream and the cross-reference stream of the sample
+	pdf, err := ParseReaderAt(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if strings.Join(pdf.Text, "|") != strings.Join(expected.Text, "|") {
+		log.Printf("expected %q, found %q\n", expected.Text, pdf.Text)
+		t.Fail()
+	}
+	if pdf.Metadata.Producer != expected.Metadata.Producer {
+		log.Printf("expected producer `%s`, found `%s`\n", expected.Metadata.Producer, pdf.Metadata.Producer)
+		t.Fail()
+	}
+
+	// the content of the page is replaced by an incremental update
+	str := build_pdf_xref([]string{
+		"<</Type/Catalog/Pages 2 0 R/AcroForm<</Fields[5 0 R]>>>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Contents 4 0 R>>",
+		stream_obj("", "BT (Old) Tj ET"),
+		"<</FT/Tx/T(name)/V(Alice)>>",
+	}, map[int]string{
+		4: stream_obj("", "BT (New) Tj ET"),
+	})
+	pdf, err = ParseReaderAt(strings.NewReader(str), int64(len(str)))
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if strings.Join(pdf.Text, "|") != "New" {
+		log.Printf("expected `New`, found %q\n", pdf.Text)
+		t.Fail()
+	}
+	if v := pdf.FieldValues()["name"]; v != "Alice" {
+		log.Printf("expected the field `name` to be `Alice`, found `%s`\n", v)
+		t.Fail()
+	}
+
+	// only the documents without a xref are left to Parse
+	str = build_pdf("<</Type/Catalog/Pages 2 0 R>>", "<</Type/Pages/Kids[]/Count 0>>")
+	if _, err := ParseReaderAt(strings.NewReader(str), int64(len(str))); err == nil {
+		log.Println("expected an error without xref")
+		t.Fail()
+	} else if _, ok := err.(*XrefError); !ok {
+		log.Printf("expected a *XrefError, found %T %v\n", err, err)
+		t.Fail()
+	}
+	if _, err := ParseReaderAt(strings.NewReader("hello"), 5); err == nil {
+		log.Println("expected an error for a document without header")
+		t.Fail()
+	} else if _, ok := err.(*XrefError); ok {
+		log.Printf("a document without header is not a *XrefError: %v\n", err)
+		t.Fail()
+	}
+}
+
+func TestXRefStreamWidths(t *testing.T) {
+	log.SetPrefix("TestXRefStreamWidths: ")
+	for w, ok := range map[string]bool{
+		"[1 2 1]":  true,
+		"[1 -2 1]": false,
+		"[1 9 1]":  false,
+		"[0 0 0]":  false,
+	} {
+		str := "1 0 obj\n" + stream_obj("/Type/XRef/Size 2/W"+w, "\x01\x00\x0f\x00\x01\x00\x20\x00") + "\nendobj\n"
+		src := &source{r: strings.NewReader(str), size: int64(len(str)), xref: map[obj_int]xref_entry{}, cache: map[obj_int]obj_ind{}}
+		_, err := src.xref_stream(&pdf{src: src}, 0)
+		if (err == nil) != ok {
+			log.Printf("/W %s: unexpected error %v\n", w, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestUnpredict(t *testing.T) {
+	log.SetPrefix("TestUnpredict: ")
+	var p pdf
+	// two rows of 3 columns, the second with the Up predictor
+	data := []byte{0, 1, 2, 3, 2, 1, 1, 1}
+	result, err := p.unpredict(data, obj_dict{"Predictor": obj{obj_int(12), 0, 0}, "Columns": obj{obj_int(3), 0, 0}})
+	if err != nil || !bytes.Equal(result, []byte{1, 2, 3, 2, 3, 4}) {
+		log.Printf("expected [1 2 3 2 3 4], found %v %v\n", result, err)
+		t.Fail()
+	}
+}
+
+func TestLexer(t *testing.T) {
+	log.SetPrefix("TestLexer: ")
+	// CR only line endings, a dictionary split in lines, names with `#xx` and a
+	// string with balanced parentheses over two lines.
+	content := "BT\r/F#31 12 Tf\r(a (b)\rc) Tj\rET"
+	str := strings.ReplaceAll(build_pdf(
+		"<</Type/Catalog\n/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]\n/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Resources<</Font<</F1<</Type/Font/Subtype/Type1/BaseFont/Helvetica>>>>>>/Contents 4 0 R/Name/A#20B>>",
+		stream_obj("", content),
+	), "\n", "\r")
+	pdf, err := Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if strings.Join(pdf.Text, "|") != "a (b)\nc" {
+		log.Printf("expected `a (b)\\nc`, found %q\n", pdf.Text)
+		t.Fail()
+	}
+	pages := pdf.pages()
+	if len(pages) != 1 || pages[0].dict["Name"].Type != obj_named("A B") {
+		log.Printf("expected one page with the name `A B`, found %v\n", pages)
+		t.Fail()
+	}
+
+	// the data of a stream with /Length may have `endstream` and any byte
+	data := "\r\nendstream\n\x00\xff"
+	str = build_pdf(fmt.Sprintf("<</Length %d>>\nstream\n%s\nendstream", len(data), data))
+	pdf, err = Parse([]byte(str), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	ind, err := pdf.lookup(1)
+	if err != nil || string(ind.stream.decoded_content) != data {
+		log.Printf("expected the stream %q, found %q %v\n", data, ind.stream.decoded_content, err)
+		t.Fail()
+	}
+
+	// an empty hexadecimal string is shown as `()`, the byte after its `>` is the
+	// next token
+	for content, expected := range map[string]string{
+		"BT <> Tj ET":             "",
+		"BT <>Tj (C) Tj ET":       "|C",
+		"BT [<>(A)] TJ (B) Tj ET": "A|B",
+		"BT [(A)<>] TJ <41>Tj ET": "A|A",
+	} {
+		str = build_pdf(
+			"<</Type/Catalog/Pages 2 0 R>>",
+			"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+			"<</Type/Page/Parent 2 0 R/Contents 4 0 R>>",
+			stream_obj("", content),
+		)
+		pdf, err = Parse([]byte(str), nil, nil)
+		if err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		if text := strings.Join(pdf.Text, "|"); text != expected {
+			log.Printf("`%s`: expected `%s`, found %q\n", content, expected, pdf.Text)
+			t.Fail()
+		}
+	}
+
+	lex := new_lexer([]byte("<</A[1 2]>>%c\r\n(s)<>1"))
+	var tokens []string
+	for {
+		token, ok := lex.next()
+		if !ok {
+			break
+		}
+		switch token {
+		case "%":
+			token += lex.read_comment()
+		case "(":
+			strl, _ := lex.read_strl()
+			token += string(strl)
+		case "/":
+			token += lex.read_name()
+		case "<":
+			strh, _ := lex.read_strh()
+			token += strh + ">"
+		}
+		tokens = append(tokens, fmt.Sprintf("%s@%d:%d", token, lex.tok_line, lex.tok_col))
+	}
+	expected := "<<@1:1 /A@1:3 [@1:5 1@1:6 2@1:8 ]@1:9 >>@1:10 %c@1:12 (s@2:1 <>@2:4 1@2:6"
+	if strings.Join(tokens, " ") != expected {
+		log.Printf("expected `%s`, found `%s`\n", expected, strings.Join(tokens, " "))
+		t.Fail()
+	}
+}
+
+func TestStrlEscapes(t *testing.T) {
+	log.SetPrefix("TestStrlEscapes: ")
+	for _, c := range []struct{ str, expected string }{
+		{`(plain)`, "plain"},
+		{`(\n\r\t\b\f)`, "\n\r\t\b\f"},
+		{`(\(\)\\)`, "()\\"},
+		{`(a(b)c)`, "a(b)c"},
+		{`(\\)`, "\\"},
+		{`(\\\))`, "\\)"},
+		{`(\351t\351)`, "\xe9t\xe9"},
+		{`(\0053)`, "\x053"},
+		{`(\53)`, "+"},
+		{`(\5x)`, "\x05x"},
+		{`(\501)`, "A"}, // the high-order overflow is ignored
+		{"(one \\\ntwo)", "one two"},
+		{"(one \\\r\ntwo)", "one two"},
+		{"(one \\\rtwo)", "one two"},
+		{"(a\r\nb\rc\nd)", "a\nb\nc\nd"},
+		{`(\q)`, "q"},
+		{`()`, ""},
+	} {
+		strl, balance := read_strl([]byte(c.str[1:]))
+		if balance != 0 {
+			log.Printf("%q: expected the string to be closed, %d `(` left\n", c.str, balance)
+			t.Fail()
+			continue
+		}
+		if s := string(unescape_strl([]byte(strl))); s != c.expected {
+			log.Printf("%q: expected %q, found %q\n", c.str, c.expected, s)
+			t.Fail()
+		}
+	}
+	if _, balance := read_strl([]byte(`a (b\)`)); balance != 2 {
+		log.Printf("expected 2 `(` left, found %d\n", balance)
+		t.Fail()
+	}
+}
+
+// The content streams are parsed in parallel, the text must still be in the
+// order of the document.
+func TestParallelContent(t *testing.T) {
+	log.SetPrefix("TestParallelContent: ")
+	const n = 20
+	objs := []string{"<</Type/Catalog/Pages 2 0 R>>", ""}
+	var kids, expected []string
+	for i := 0; i < n; i++ {
+		page := len(objs) + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+		objs = append(objs,
+			fmt.Sprintf("<</Type/Page/Parent 2 0 R/Resources<</Font<</F1 %d 0 R>>>>/Contents %d 0 R>>", page+2, page+1),
+			stream_obj("", fmt.Sprintf("BT /F1 12 Tf /P <</MCID 0>> BDC (Page %d) Tj EMC ET", i)),
+			"<</Type/Font/Subtype/Type1/BaseFont/Helvetica>>")
+		expected = append(expected, fmt.Sprintf("Page %d", i))
+	}
+	objs[1] = fmt.Sprintf("<</Type/Pages/Kids[%s]/Count %d>>", strings.Join(kids, " "), n)
+	pdf, err := Parse([]byte(build_pdf(objs...)), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if strings.Join(pdf.Text, "|") != strings.Join(expected, "|") {
+		log.Printf("expected %q, found %q\n", expected, pdf.Text)
+		t.Fail()
+	}
+	for i, pg := range pdf.pages() {
+		if s := pdf.mcids[pg.id][0]; s != expected[i] {
+			log.Printf("page %d: expected the MCID 0 to be `%s`, found `%s`\n", i, expected[i], s)
+			t.Fail()
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	log.SetPrefix("TestInspect: ")
+	str := build_pdf_xref([]string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Contents 4 0 R/Name/A#20B/T(a\\(b\\)\\n)/H<0aff>>>",
+		stream_obj("", "BT (Hi) Tj ET"),
+		"[1 2.5 true null /N]",
+	}, nil)
+	pdf, err := ParseReaderAt(strings.NewReader(str), int64(len(str)))
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	types := []string{}
+	for _, o := range pdf.Objects() {
+		types = append(types, fmt.Sprintf("%d %s %v", o.Id, o.Type, o.Stream))
+	}
+	expected := []string{"1 /Catalog false", "2 /Pages false", "3 /Page false", "4 stream true", "5 array false"}
+	if strings.Join(types, "|") != strings.Join(expected, "|") {
+		log.Printf("expected %q, found %q\n", expected, types)
+		t.Fail()
+	}
+	xref := pdf.XRef()
+	if len(xref) != 6 || xref[0].Kind != "free" || xref[4].Kind != "offset" || xref[4].Offset != int64(strings.Index(str, "4 0 obj")) {
+		log.Printf("unexpected xref %v\n", xref)
+		t.Fail()
+	}
+	if s, _ := pdf.Object(3); s != "3 0 obj\n<<\n  /Contents 4 0 R\n  /H <0aff>\n  /Name /A#20B\n  /Parent 2 0 R\n  /T (a\\(b\\)\\n)\n  /Type /Page\n>>\nendobj\n" {
+		log.Printf("unexpected obj 3:\n%s", s)
+		t.Fail()
+	}
+	if s, _ := pdf.Object(5); s != "5 0 obj\n[1 2.5 true null /N]\nendobj\n" {
+		log.Printf("unexpected obj 5:\n%s", s)
+		t.Fail()
+	}
+	if data, err := pdf.Stream(4, true); err != nil || string(data) != "BT (Hi) Tj ET" {
+		log.Printf("unexpected stream 4 `%s` %v\n", data, err)
+		t.Fail()
+	}
+	if _, err := pdf.Stream(3, false); err == nil {
+		log.Printf("expected obj 3 not to be a stream\n")
+		t.Fail()
+	}
+	if !strings.Contains(pdf.Trailer(), "/Root 1 0 R") {
+		log.Printf("unexpected trailer %s\n", pdf.Trailer())
+		t.Fail()
+	}
+}
+
+func TestTrace(t *testing.T) {
+	log.SetPrefix("TestTrace: ")
+	pdf, err := Parse([]byte(build_pdf(
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Resources<</Font<</F1 5 0 R>>>>/Contents 4 0 R>>",
+		stream_obj("", "BT /F1 10 Tf 1 0 0 1 50 700 Tm [(A) -600 (B)] TJ ET"),
+		"<</Type/Font/Subtype/Type1/BaseFont/Helvetica>>",
+	)), nil, nil)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	var events []TraceEvent
+	if err := pdf.Trace(1, func(e TraceEvent) { events = append(events, e) }); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	var ops []string
+	for _, e := range events {
+		ops = append(ops, e.Operator+strings.Join(e.Operands, ","))
+	}
+	expected := []string{"BT", "Tf/F1,10", "Tm1,0,0,1,50,700", "TJ[(A) -600 (B)]", "ET"}
+	if strings.Join(ops, "|") != strings.Join(expected, "|") {
+		log.Printf("expected %q, found %q\n", expected, ops)
+		t.FailNow()
+	}
+	tj := events[3]
+	if tj.Page != 1 || tj.Stream != 4 || tj.Op != 3 || tj.Font != "Helvetica" || tj.Size != 10 ||
+		strings.Join(tj.Text, "|") != "A|B" || tj.TM[4] <= 50 {
+		log.Printf("unexpected TJ event %+v\n", tj)
+		t.Fail()
+	}
+	if err := pdf.Trace(2, func(TraceEvent) {}); err == nil {
+		log.Printf("expected the page 2 not to be found\n")
+		t.Fail()
+	}
+}
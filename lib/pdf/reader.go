@@ -0,0 +1,408 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+)
+
+// Reading a document from an io.ReaderAt: only the cross-reference sections are
+// read up front, each object is read from its offset when it is needed.
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf#page=47
+
+// xref_entry is where an object is, from a xref table or a cross-reference stream.
+type xref_entry struct {
+	kind   int     // 0 free, 1 in the file, 2 compressed in an object stream
+	offset int64   // kind 1
+	stream obj_int // kind 2, the object stream and the index of the object in it
+	index  int
+}
+
+// source reads the objects of a document on demand. Objects without a stream and
+// the parsed object streams are kept, the other streams(pages content, fonts,
+// images) are read again each time they are needed.
+type source struct {
+	r       io.ReaderAt
+	size    int64
+	xref    map[obj_int]xref_entry
+	trailer obj_dict
+	cache   map[obj_int]obj_ind
+}
+
+// XrefError is the error of ParseReaderAt when the cross-reference sections
+// are missing or broken, only Parse can read these documents, from the start.
+type XrefError struct {
+	Err error
+}
+
+func (e *XrefError) Error() string {
+	return e.Err.Error()
+}
+
+// ParseReaderAt does the same as Parse for a document of `size` bytes read from
+// `r`, without having the whole document in memory. The error is a *XrefError
+// when the objects can't be found without reading the whole document.
+func ParseReaderAt(r io.ReaderAt, size int64) (pdf, error) {
+	var result pdf
+	src := &source{r: r, size: size, xref: map[obj_int]xref_entry{}, cache: map[obj_int]obj_ind{}}
+	result.src = src
+
+	header := src.read(0, 16) // %PDF-1.7
+	if !bytes.HasPrefix(header, []byte("%PDF-")) {
+		return result, errors.New("ERROR: the document doesn't start with `%PDF-`\n")
+	}
+	fmt.Sscanf(string(header[5:]), "%d.%d", &result.ver.major, &result.ver.minor)
+	if result.ver.major == 0 {
+		return result, errors.New(fmt.Sprintf("ERROR: Failed to parse PDF version from `%s`\n", bytes.TrimSpace(header)))
+	}
+	startxref, err := src.startxref()
+	if err != nil {
+		return result, &XrefError{err}
+	}
+	if err := src.read_xref(&result, startxref); err != nil {
+		return result, &XrefError{err}
+	}
+	if src.trailer == nil {
+		return result, &XrefError{errors.New("ERROR: trailer not found\n")}
+	}
+
+	for _, pg := range result.pages() {
+		for _, id := range result.page_contents(pg) {
+			ind, err := result.lookup(id)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			data, err := result.decode_stream(ind)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			ctx := new_parse_ctx(&result, pg.id, pg.resources)
+			_pdf, err := parse(data, result.color_space, nil, ctx)
+			if err != nil {
+				return result, err
+			}
+			result.add_text(_pdf.objs)
+			result.add_mcids(ctx)
+		}
+	}
+	result.document()
+	return result, nil
+}
+
+// read returns `n` bytes at `offset`, less at the end of the document.
+func (s *source) read(offset int64, n int) []byte {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= s.size {
+		return nil
+	}
+	if int64(n) > s.size-offset {
+		n = int(s.size - offset)
+	}
+	buf := make([]byte, n)
+	n, _ = s.r.ReadAt(buf, offset)
+	return buf[:n]
+}
+
+// startxref returns the offset of the last cross-reference section, it is after
+// the `startxref` at the end of the document.
+func (s *source) startxref() (int64, error) {
+	n := int64(1024)
+	if n > s.size {
+		n = s.size
+	}
+	tail := s.read(s.size-n, int(n))
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i == -1 {
+		return 0, errors.New("ERROR: `startxref` not found at the end of the document\n")
+	}
+	fields := bytes.Fields(tail[i+len("startxref"):])
+	if len(fields) == 0 {
+		return 0, errors.New("ERROR: expected the offset after `startxref`, found EOF\n")
+	}
+	offset, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("ERROR: expected the offset after `startxref`, found `%s`\n", fields[0]))
+	}
+	return offset, nil
+}
+
+// read_xref reads the cross-reference section at `offset` and the older ones
+// it points to with /Prev. The entries of the newer sections win.
+func (s *source) read_xref(p *pdf, offset int64) error {
+	visited := map[int64]bool{}
+	for !visited[offset] {
+		visited[offset] = true
+		var trailer obj_dict
+		var err error
+		if bytes.HasPrefix(bytes.TrimSpace(s.read(offset, 32)), []byte("xref")) {
+			trailer, err = s.xref_table(offset)
+		} else {
+			trailer, err = s.xref_stream(p, offset)
+		}
+		if err != nil {
+			return err
+		}
+		if s.trailer == nil {
+			s.trailer = trailer
+		} else {
+			for key, value := range trailer {
+				if _, ok := s.trailer[key]; !ok {
+					s.trailer[key] = value
+				}
+			}
+		}
+		// hybrid files have the objects compressed in object streams only in
+		// the stream /XRefStm, readers of PDF 1.4 don't see them.
+		if stm, ok := trailer["XRefStm"].Type.(obj_int); ok && !visited[int64(stm)] {
+			visited[int64(stm)] = true
+			if _, err := s.xref_stream(p, int64(stm)); err != nil {
+				return err
+			}
+		}
+		prev, ok := trailer["Prev"].Type.(obj_int)
+		if !ok {
+			break
+		}
+		offset = int64(prev)
+	}
+	return nil
+}
+
+func (s *source) add(id obj_int, e xref_entry) {
+	if _, ok := s.xref[id]; !ok {
+		s.xref[id] = e
+	}
+}
+
+// xref_table reads a `xref` table and its trailer dictionary.
+func (s *source) xref_table(offset int64) (obj_dict, error) {
+	var data []byte
+	for n := 4096; ; n *= 2 {
+		data = s.read(offset, n)
+		if end := bytes.Index(data, []byte("startxref")); end != -1 {
+			data = data[:end]
+			break
+		}
+		if len(data) < n {
+			return nil, errors.New(fmt.Sprintf("ERROR: `startxref` not found after the xref at %d\n", offset))
+		}
+	}
+	t := bytes.Index(data, []byte("trailer"))
+	if t == -1 {
+		return nil, errors.New(fmt.Sprintf("ERROR: `trailer` not found after the xref at %d\n", offset))
+	}
+	// subsections of `first count` followed by `count` entries of `offset generation n|f`
+	fields := bytes.Fields(data[bytes.Index(data, []byte("xref"))+len("xref") : t])
+	for i := 0; i+1 < len(fields); {
+		first, err1 := strconv.Atoi(string(fields[i]))
+		count, err2 := strconv.Atoi(string(fields[i+1]))
+		if err1 != nil || err2 != nil {
+			return nil, errors.New(fmt.Sprintf("ERROR: expected xref subsection, found `%s %s`\n", fields[i], fields[i+1]))
+		}
+		i += 2
+		for j := 0; j < count && i+2 < len(fields); j++ {
+			id := obj_int(first + j)
+			switch string(fields[i+2]) {
+			case "n":
+				off, err := strconv.ParseInt(string(fields[i]), 10, 64)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("ERROR: expected xref offset, found `%s`\n", fields[i]))
+				}
+				s.add(id, xref_entry{kind: 1, offset: off})
+			case "f":
+				s.add(id, xref_entry{})
+			}
+			i += 3
+		}
+	}
+
+	_pdf, _, err := parse_objs(data[t+len("trailer"):], nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range _pdf.objs {
+		if dict, ok := o.Type.(obj_dict); ok {
+			return dict, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("ERROR: expected the trailer dict after the xref at %d\n", offset))
+}
+
+// xref_stream reads a cross-reference stream, its dictionary is also the trailer.
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf#page=57
+func (s *source) xref_stream(p *pdf, offset int64) (obj_dict, error) {
+	ind, err := s.read_obj(offset)
+	if err != nil {
+		return nil, err
+	}
+	if ind.metadata["Type"].Type != obj_named("XRef") {
+		return nil, errors.New(fmt.Sprintf("ERROR: expected xref or a cross-reference stream at %d\n", offset))
+	}
+	data, err := p.decode_stream(ind)
+	if err != nil {
+		return nil, err
+	}
+	w, _ := ind.metadata["W"].Type.(obj_array)
+	if len(w) != 3 {
+		return nil, errors.New(fmt.Sprintf("ERROR: expected /W with 3 widths in the cross-reference stream %d\n", ind.id))
+	}
+	w0, w1, w2 := int(number(w[0])), int(number(w[1])), int(number(w[2]))
+	// NOTE(elias): the fields are at most 8 bytes(int64), an empty row would never move.
+	for _, n := range []int{w0, w1, w2} {
+		if n < 0 || n > 8 {
+			return nil, errors.New(fmt.Sprintf("ERROR: invalid /W width %d in the cross-reference stream %d\n", n, ind.id))
+		}
+	}
+	if w0+w1+w2 == 0 {
+		return nil, errors.New(fmt.Sprintf("ERROR: empty rows(/W [0 0 0]) in the cross-reference stream %d\n", ind.id))
+	}
+	index, _ := ind.metadata["Index"].Type.(obj_array)
+	if index == nil {
+		index = obj_array{obj{obj_int(0), 0, 0}, ind.metadata["Size"]}
+	}
+	// big-endian fields, `value` when the field is not in the stream(width 0)
+	field := func(b []byte, value int64) int64 {
+		if len(b) == 0 {
+			return value
+		}
+		value = 0
+		for _, c := range b {
+			value = value<<8 | int64(c)
+		}
+		return value
+	}
+	row := w0 + w1 + w2
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		first, count := int(number(index[i])), int(number(index[i+1]))
+		for j := 0; j < count && pos+row <= len(data); j++ {
+			b := data[pos : pos+row]
+			pos += row
+			id := obj_int(first + j)
+			f2, f3 := field(b[w0:w0+w1], 0), field(b[w0+w1:], 0)
+			switch field(b[:w0], 1) {
+			case 0:
+				s.add(id, xref_entry{})
+			case 1:
+				s.add(id, xref_entry{kind: 1, offset: f2})
+			case 2:
+				s.add(id, xref_entry{kind: 2, stream: obj_int(f2), index: int(f3)})
+			}
+		}
+	}
+	return ind.metadata, nil
+}
+
+// obj_end returns where the `endobj` of the object at the start of `data` ends,
+// or -1. Streams may have anything until `endstream`.
+func obj_end(data []byte) int {
+	end := bytes.Index(data, []byte("endobj"))
+	if s := bytes.Index(data, []byte("stream")); s != -1 && (end == -1 || s < end) {
+		e := bytes.Index(data[s:], []byte("endstream"))
+		if e == -1 {
+			return -1
+		}
+		end = bytes.Index(data[s+e:], []byte("endobj"))
+		if end == -1 {
+			return -1
+		}
+		end += s + e
+	}
+	if end == -1 {
+		return -1
+	}
+	return end + len("endobj")
+}
+
+// read_obj reads the indirect object at `offset`.
+func (s *source) read_obj(offset int64) (obj_ind, error) {
+	var data []byte
+	for n := 4096; ; n *= 2 {
+		data = s.read(offset, n)
+		if end := obj_end(data); end != -1 {
+			data = data[:end]
+			break
+		}
+		if len(data) < n {
+			return obj_ind{}, errors.New(fmt.Sprintf("ERROR: `endobj` not found for the obj at %d\n", offset))
+		}
+	}
+	_pdf, _, err := parse_objs(data, nil, nil, nil)
+	if err != nil {
+		return obj_ind{}, err
+	}
+	for _, o := range _pdf.objs {
+		if ind, ok := o.Type.(obj_ind); ok {
+			return ind, nil
+		}
+	}
+	return obj_ind{}, errors.New(fmt.Sprintf("ERROR: expected an obj at %d\n", offset))
+}
+
+// lookup is pdf.lookup for documents read with ParseReaderAt.
+func (s *source) lookup(p *pdf, id obj_int) (obj_ind, error) {
+	if ind, ok := s.cache[id]; ok {
+		return ind, nil
+	}
+	e := s.xref[id]
+	var ind obj_ind
+	switch e.kind {
+	case 1:
+		var err error
+		ind, err = s.read_obj(e.offset)
+		if err != nil {
+			return ind, err
+		}
+		if ind.id != id {
+			return obj_ind{}, errors.New(fmt.Sprintf("ERROR: expected obj %d at %d, found obj %d\n", id, e.offset, ind.id))
+		}
+	case 2:
+		stm, err := s.object_stream(p, e.stream)
+		if err != nil {
+			return ind, err
+		}
+		var ok bool
+		ind, ok = objstm_get(stm, id)
+		if !ok {
+			return ind, errors.New(fmt.Sprintf("ERROR: could not find obj %d in the object stream %d\n", id, e.stream))
+		}
+	default:
+		return ind, errors.New(fmt.Sprintf("ERROR: could not find obj %d\n", id))
+	}
+	if ind.stream.encoded_content == nil && ind.stream.decoded_content == nil {
+		s.cache[id] = ind
+	}
+	return ind, nil
+}
+
+// object_stream returns the object stream `id` with its objects parsed.
+func (s *source) object_stream(p *pdf, id obj_int) (obj_ind, error) {
+	if ind, ok := s.cache[id]; ok {
+		return ind, nil
+	}
+	if s.xref[id].kind != 1 {
+		return obj_ind{}, errors.New(fmt.Sprintf("ERROR: could not find the object stream %d\n", id))
+	}
+	ind, err := s.lookup(p, id)
+	if err != nil {
+		return ind, err
+	}
+	data, err := p.decode_stream(ind)
+	if err != nil {
+		return ind, err
+	}
+	_pdf, _, err := parse_objs(data, nil, nil, nil)
+	if err != nil {
+		return ind, err
+	}
+	ind.stream = obj_stream{encoded_content: ind.stream.encoded_content, objs: _pdf.objs}
+	s.cache[id] = ind
+	return ind, nil
+}
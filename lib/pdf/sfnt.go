@@ -0,0 +1,269 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Minimal TrueType/OpenType(sfnt) reader. Only the tables needed to map glyphs
+// back to unicode are read: cmap, post and hmtx.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otff
+
+type sfnt_cmap struct {
+	platform, encoding uint16
+	glyphs             map[uint32]uint16 // char code to glyph id
+}
+
+type sfnt struct {
+	units_per_em uint16
+	num_glyphs   int
+	cmaps        []sfnt_cmap
+	glyph_names  []string        // from the post table, indexed by glyph id
+	advances     []uint16        // from the hmtx table, indexed by glyph id
+	reverse      map[uint16]rune // glyph id to unicode from the unicode cmap subtables
+	cff          *cff            // OpenType fonts with PostScript outlines
+}
+
+func parse_sfnt(b []byte) (*sfnt, error) {
+	if len(b) < 12 {
+		return nil, errors.New("sfnt: font too short")
+	}
+	switch binary.BigEndian.Uint32(b) {
+	case 0x00010000, 0x74727565, 0x4f54544f: // 1.0, `true` and `OTTO`
+	default:
+		return nil, errors.New(fmt.Sprintf("sfnt: invalid version %x", b[:4]))
+	}
+	tables := map[string][]byte{}
+	n := int(binary.BigEndian.Uint16(b[4:]))
+	for i := 0; i < n; i++ {
+		rec := 12 + i*16
+		if rec+16 > len(b) {
+			return nil, errors.New("sfnt: table directory out of bounds")
+		}
+		tag := string(b[rec : rec+4])
+		off := int(binary.BigEndian.Uint32(b[rec+8:]))
+		length := int(binary.BigEndian.Uint32(b[rec+12:]))
+		if off < 0 || length < 0 || off+length > len(b) {
+			// NOTE(elias): subset fonts sometimes have wrong lengths, ignore the table
+			continue
+		}
+		tables[tag] = b[off : off+length]
+	}
+
+	var result sfnt
+	if head := tables["head"]; len(head) >= 20 {
+		result.units_per_em = binary.BigEndian.Uint16(head[18:])
+	}
+	if result.units_per_em == 0 {
+		result.units_per_em = 1000
+	}
+	if maxp := tables["maxp"]; len(maxp) >= 6 {
+		result.num_glyphs = int(binary.BigEndian.Uint16(maxp[4:]))
+	}
+	if cmap := tables["cmap"]; cmap != nil {
+		result.cmaps = parse_sfnt_cmap(cmap)
+	}
+	result.reverse = map[uint16]rune{}
+	for _, cmap := range result.cmaps {
+		if !(cmap.platform == 0 || (cmap.platform == 3 && (cmap.encoding == 1 || cmap.encoding == 10))) {
+			continue
+		}
+		for c, gid := range cmap.glyphs {
+			// several codes can point to the same glyph, keep the lowest to be deterministic
+			if r, ok := result.reverse[gid]; !ok || rune(c) < r {
+				result.reverse[gid] = rune(c)
+			}
+		}
+	}
+	if post := tables["post"]; post != nil {
+		result.glyph_names = parse_sfnt_post(post)
+	}
+	if hhea := tables["hhea"]; len(hhea) >= 36 {
+		nmetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+		hmtx := tables["hmtx"]
+		for i := 0; i < nmetrics && i*4+2 <= len(hmtx); i++ {
+			result.advances = append(result.advances, binary.BigEndian.Uint16(hmtx[i*4:]))
+		}
+		// the remaining glyphs have the same advance as the last one
+		for len(result.advances) > 0 && len(result.advances) < result.num_glyphs {
+			result.advances = append(result.advances, result.advances[len(result.advances)-1])
+		}
+	}
+	if data := tables["CFF "]; data != nil {
+		c, err := parse_cff(data)
+		if err == nil {
+			result.cff = c
+		}
+	}
+	return &result, nil
+}
+
+func parse_sfnt_cmap(b []byte) []sfnt_cmap {
+	var result []sfnt_cmap
+	if len(b) < 4 {
+		return result
+	}
+	n := int(binary.BigEndian.Uint16(b[2:]))
+	for i := 0; i < n; i++ {
+		rec := 4 + i*8
+		if rec+8 > len(b) {
+			break
+		}
+		cmap := sfnt_cmap{
+			platform: binary.BigEndian.Uint16(b[rec:]),
+			encoding: binary.BigEndian.Uint16(b[rec+2:]),
+			glyphs:   map[uint32]uint16{},
+		}
+		off := int(binary.BigEndian.Uint32(b[rec+4:]))
+		if off+4 > len(b) {
+			continue
+		}
+		sub := b[off:]
+		switch binary.BigEndian.Uint16(sub) {
+		case 0: // byte encoding table
+			for c := 0; c < 256 && 6+c < len(sub); c++ {
+				cmap.glyphs[uint32(c)] = uint16(sub[6+c])
+			}
+		case 4: // segment mapping to delta values
+			if len(sub) < 14 {
+				continue
+			}
+			segx2 := int(binary.BigEndian.Uint16(sub[6:]))
+			ends := 14
+			starts := ends + segx2 + 2
+			deltas := starts + segx2
+			ranges := deltas + segx2
+			if ranges+segx2 > len(sub) {
+				continue
+			}
+			for s := 0; s < segx2; s += 2 {
+				end := uint32(binary.BigEndian.Uint16(sub[ends+s:]))
+				start := uint32(binary.BigEndian.Uint16(sub[starts+s:]))
+				delta := binary.BigEndian.Uint16(sub[deltas+s:])
+				offset := int(binary.BigEndian.Uint16(sub[ranges+s:]))
+				for c := start; c <= end && c != 0xffff; c++ {
+					var gid uint16
+					if offset == 0 {
+						gid = uint16(c) + delta
+					} else {
+						at := ranges + s + offset + int(c-start)*2
+						if at+2 > len(sub) {
+							break
+						}
+						gid = binary.BigEndian.Uint16(sub[at:])
+						if gid != 0 {
+							gid += delta
+						}
+					}
+					if gid != 0 {
+						cmap.glyphs[c] = gid
+					}
+				}
+			}
+		case 6: // trimmed table mapping
+			if len(sub) < 10 {
+				continue
+			}
+			first := uint32(binary.BigEndian.Uint16(sub[6:]))
+			count := int(binary.BigEndian.Uint16(sub[8:]))
+			for c := 0; c < count && 10+c*2+2 <= len(sub); c++ {
+				cmap.glyphs[first+uint32(c)] = binary.BigEndian.Uint16(sub[10+c*2:])
+			}
+		case 12: // segmented coverage
+			if len(sub) < 16 {
+				continue
+			}
+			ngroups := int(binary.BigEndian.Uint32(sub[12:]))
+			for g := 0; g < ngroups && 16+g*12+12 <= len(sub); g++ {
+				group := sub[16+g*12:]
+				start := binary.BigEndian.Uint32(group)
+				end := binary.BigEndian.Uint32(group[4:])
+				gid := binary.BigEndian.Uint32(group[8:])
+				for c := start; c <= end && c-start < 0x10000; c++ {
+					cmap.glyphs[c] = uint16(gid + c - start)
+				}
+			}
+		default:
+			continue
+		}
+		result = append(result, cmap)
+	}
+	return result
+}
+
+func parse_sfnt_post(b []byte) []string {
+	if len(b) < 32 {
+		return nil
+	}
+	switch binary.BigEndian.Uint32(b) {
+	case 0x00010000:
+		return mac_glyph_names[:]
+	case 0x00020000:
+		if len(b) < 34 {
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(b[32:]))
+		if 34+n*2 > len(b) {
+			return nil
+		}
+		// Pascal strings for the glyphs not in the standard mac ordering
+		var names []string
+		for pos := 34 + n*2; pos < len(b); {
+			l := int(b[pos])
+			if pos+1+l > len(b) {
+				break
+			}
+			names = append(names, string(b[pos+1:pos+1+l]))
+			pos += 1 + l
+		}
+		result := make([]string, n)
+		for i := range result {
+			index := int(binary.BigEndian.Uint16(b[34+i*2:]))
+			if index < len(mac_glyph_names) {
+				result[i] = mac_glyph_names[index]
+			} else if index-len(mac_glyph_names) < len(names) {
+				result[i] = names[index-len(mac_glyph_names)]
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// lookup_cmap returns the glyph id for `code` using the first cmap subtable found
+// for the platform/encoding.
+func (f *sfnt) lookup_cmap(platform, encoding uint16, code uint32) (uint16, bool) {
+	for _, cmap := range f.cmaps {
+		if cmap.platform == platform && cmap.encoding == encoding {
+			gid, ok := cmap.glyphs[code]
+			return gid, ok
+		}
+	}
+	return 0, false
+}
+
+// unicode returns the text for the glyph `gid`, using the unicode cmap subtables
+// or its name in the post table.
+func (f *sfnt) unicode(gid uint16) string {
+	if r, ok := f.reverse[gid]; ok {
+		return string(r)
+	}
+	if int(gid) < len(f.glyph_names) {
+		if s := glyph_to_unicode(f.glyph_names[gid]); s != "" {
+			return s
+		}
+	}
+	if f.cff != nil {
+		return f.cff.unicode(gid)
+	}
+	return ""
+}
+
+// width returns the advance of the glyph in 1/1000 of the text space.
+func (f *sfnt) width(gid uint16) (float64, bool) {
+	if int(gid) >= len(f.advances) {
+		return 0, false
+	}
+	return float64(f.advances[gid]) * 1000 / float64(f.units_per_em), true
+}
@@ -0,0 +1,126 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// stream_job is a stream of p.objs to be parsed, with the state of its page
+// for content streams.
+type stream_job struct {
+	index obj_int // in p.objs
+	ctx   *parse_ctx
+}
+
+// parse_streams decodes and parses the streams of `jobs` with `workers`
+// goroutines. The results are added to the document in the order of the jobs,
+// so the text doesn't depend on which stream is parsed first. Nothing of the
+// document changes while the streams are parsed, see load_fonts.
+func (p *pdf) parse_streams(jobs []stream_job, workers int) error {
+	type parsed struct {
+		ind       obj_ind
+		resources []obj_resources
+		err       error
+	}
+	results := make([]parsed, len(jobs))
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				r := &results[k]
+				r.ind, r.resources, r.err = p.parse_stream(jobs[k])
+			}
+		}()
+	}
+	for k := range jobs {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+
+	for k, job := range jobs {
+		r := results[k]
+		if r.err != nil {
+			log.Printf("%s", r.err)
+			return r.err
+		}
+		p.objs[job.index].Type = r.ind
+		p.Resources = append(p.Resources, r.resources...)
+		if job.ctx != nil {
+			p.add_mcids(job.ctx)
+		}
+	}
+	return nil
+}
+
+// parse_stream decodes the stream of the job and parses it.
+func (p *pdf) parse_stream(job stream_job) (obj_ind, []obj_resources, error) {
+	ind, err := p.decode_delayed(p.objs[job.index].Type.(obj_ind))
+	if err != nil {
+		return ind, nil, err
+	}
+	_pdf, err := parse(ind.stream.decoded_content, p.color_space, p.Resources, job.ctx)
+	if err != nil {
+		return ind, nil, err
+	}
+	ind.stream.objs = _pdf.objs
+	return ind, _pdf.Resources, nil
+}
+
+// decode_delayed decodes the stream of `ind` when the parser left it encoded.
+// When /Length is an indirect object the parser reads until `endstream`, the
+// data is cut to the /Length here.
+func (p *pdf) decode_delayed(ind obj_ind) (obj_ind, error) {
+	if len(ind.stream.decoded_content) > 0 || len(ind.stream.encoded_content) == 0 {
+		return ind, nil
+	}
+	length := len(ind.stream.encoded_content)
+	if ref, ok := ind.metadata["Length"].Type.(obj_ref); ok {
+		l, ok := p.resolve_number(obj{ref, 0, 0})
+		if !ok {
+			return ind, errors.New(fmt.Sprintf("ERROR: failed to get the length(%d 0 R) of the stream of obj %d\n", ref.id, ind.id))
+		}
+		length = int(l)
+	}
+	if length < len(ind.stream.encoded_content) {
+		ind.stream.encoded_content = ind.stream.encoded_content[:length]
+	} else if length > len(ind.stream.encoded_content) {
+		log.Printf("ERROR: the stream of obj %d has %d bytes, its /Length is %d\n", ind.id, len(ind.stream.encoded_content), length)
+	}
+	var err error
+	ind.stream.decoded_content, err = p.decode_stream(ind)
+	return ind, err
+}
+
+// load_fonts loads the fonts of the pages and of the Form XObjects they paint,
+// p.fonts is not changed while the content streams are parsed in parallel.
+func (p *pdf) load_fonts() {
+	visited := map[obj_int]bool{}
+	var walk func(resources obj_dict)
+	walk = func(resources obj_dict) {
+		for _, o := range p.resolve_dict(resources["Font"]) {
+			p.load_font(o)
+		}
+		for _, o := range p.resolve_dict(resources["XObject"]) {
+			ref, ok := o.Type.(obj_ref)
+			if !ok || visited[ref.id] {
+				continue
+			}
+			visited[ref.id] = true
+			if ind, ok := p.resolve(o).Type.(obj_ind); ok && ind.metadata["Subtype"].Type == obj_named("Form") {
+				walk(p.resolve_dict(ind.metadata["Resources"]))
+			}
+		}
+	}
+	for _, pg := range p.pages() {
+		walk(pg.resources)
+	}
+}
@@ -0,0 +1,256 @@
+package pdf
+
+import (
+	"log"
+	"strings"
+)
+
+// Marked content(BMC/BDC … EMC) and the structure tree of tagged PDFs.
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf#page=560
+
+type marked_content struct {
+	tag         obj_named
+	mcid        int // -1 when the sequence has no /MCID
+	actual_text *string
+	alt         *string
+	start       int // size of the operand stack at BMC/BDC, the text shown after it is part of the sequence
+}
+
+// StructElement is a node of the structure tree(/StructTreeRoot) of a tagged PDF.
+type StructElement struct {
+	Type string // standard structure type(Table, TR, TD, P…) after the /RoleMap
+	Text string // the text of the element and its kids
+	Kids []StructElement
+}
+
+func (ctx *parse_ctx) begin_marked_content(operator string, operands []obj) {
+	mc := marked_content{mcid: -1}
+	props := obj_dict{}
+	switch operator {
+	case "BMC":
+		if len(operands) < 1 {
+			return
+		}
+		mc.tag, _ = operands[len(operands)-1].Type.(obj_named)
+		mc.start = len(operands) - 1
+	case "BDC":
+		if len(operands) < 2 {
+			return
+		}
+		mc.tag, _ = operands[len(operands)-2].Type.(obj_named)
+		mc.start = len(operands) - 2
+		switch v := operands[len(operands)-1].Type.(type) {
+		case obj_dict:
+			props = v
+		case obj_named: // named resource in /Properties
+			props = ctx.doc.resolve_dict(ctx.doc.resolve_dict(ctx.resources["Properties"])[v])
+		}
+	}
+	if mcid, ok := props["MCID"].Type.(obj_int); ok {
+		mc.mcid = int(mcid)
+	}
+	if s, ok := ctx.doc.resolve_text(props["ActualText"]); ok {
+		mc.actual_text = &s
+	}
+	if s, ok := ctx.doc.resolve_text(props["Alt"]); ok {
+		mc.alt = &s
+	}
+	ctx.marked = append(ctx.marked, mc)
+}
+
+// end_marked_content closes the last sequence. The text shown inside it is
+// replaced by its /ActualText, /Alt is used when it doesn't show any text(figures).
+func (ctx *parse_ctx) end_marked_content(objs []obj) []obj {
+	if len(ctx.marked) == 0 {
+		log.Println("ERROR: `EMC` without `BMC` or `BDC`")
+		return objs
+	}
+	mc := ctx.marked[len(ctx.marked)-1]
+	ctx.marked = ctx.marked[:len(ctx.marked)-1]
+	if mc.start > len(objs) {
+		mc.start = len(objs)
+	}
+	var text strings.Builder
+	for _, o := range objs[mc.start:] {
+		if s, ok := text_of(o); ok {
+			text.WriteString(s)
+		}
+	}
+	replacement := mc.actual_text
+	if replacement == nil && mc.alt != nil && strings.TrimSpace(text.String()) == "" {
+		replacement = mc.alt
+	}
+	if replacement != nil {
+		// the replacement is where the first text of the sequence was
+		shown := obj_text{text: *replacement, page: ctx.page}
+		shown.x, shown.y = ctx.position()
+		found := false
+		kept := objs[:mc.start]
+		for _, o := range objs[mc.start:] {
+			if t, ok := o.Type.(obj_text); ok && !found {
+				shown.x, shown.y = t.x, t.y
+				found = true
+			}
+			if _, ok := text_of(o); !ok {
+				kept = append(kept, o)
+			}
+		}
+		objs = append(kept, obj{shown, 0, 0})
+		text.Reset()
+		text.WriteString(*replacement)
+	}
+	if mc.mcid >= 0 && ctx.page != 0 {
+		ctx.mcids[mc.mcid] += text.String()
+	}
+	return objs
+}
+
+// add_mcids adds the text of the marked content found by `ctx` to the page.
+func (p *pdf) add_mcids(ctx *parse_ctx) {
+	if len(ctx.mcids) == 0 || ctx.page == 0 {
+		return
+	}
+	if p.mcids == nil {
+		p.mcids = map[obj_int]map[int]string{}
+	}
+	if p.mcids[ctx.page] == nil {
+		p.mcids[ctx.page] = map[int]string{}
+	}
+	for mcid, text := range ctx.mcids {
+		p.mcids[ctx.page][mcid] += text
+	}
+}
+
+// text_of returns the text of the strings left by the text showing operators.
+func text_of(o obj) (string, bool) {
+	switch v := o.Type.(type) {
+	case obj_str:
+		return string(v), true
+	case obj_strl:
+		return string(v), true
+	case obj_strh:
+		return string(v), true
+	case obj_text:
+		return v.text, true
+	}
+	return "", false
+}
+
+// structure reads the structure tree, using the text of the marked content
+// collected while parsing the pages.
+func (p *pdf) structure() []StructElement {
+	catalog := p.catalog()
+	if catalog == nil {
+		return nil
+	}
+	root := p.resolve_dict(catalog["StructTreeRoot"])
+	if root == nil {
+		return nil
+	}
+	role_map := p.resolve_dict(root["RoleMap"])
+	role := func(s obj_named) string {
+		// custom types are mapped to the standard ones, maybe in more than one step.
+		for i := 0; i < 10; i++ {
+			mapped, ok := role_map[s].Type.(obj_named)
+			if !ok || mapped == s {
+				break
+			}
+			s = mapped
+		}
+		return string(s)
+	}
+
+	visited := map[obj_int]bool{}
+	var element func(dict obj_dict, pg obj_int) StructElement
+	// kids adds the content of /K to the element `e`
+	var kids func(o obj, pg obj_int, e *StructElement, parts *[]string)
+	kids = func(o obj, pg obj_int, e *StructElement, parts *[]string) {
+		if ref, ok := o.Type.(obj_ref); ok {
+			if visited[ref.id] {
+				return
+			}
+			visited[ref.id] = true
+		}
+		switch v := p.resolve(o).Type.(type) {
+		case obj_int: // MCID in the page of the element
+			*parts = append(*parts, p.mcids[pg][int(v)])
+		case obj_array:
+			for _, k := range v {
+				kids(k, pg, e, parts)
+			}
+		case obj_dict:
+			if ref, ok := v["Pg"].Type.(obj_ref); ok {
+				pg = ref.id
+			}
+			switch v["Type"].Type {
+			case obj_named("MCR"):
+				if mcid, ok := v["MCID"].Type.(obj_int); ok {
+					*parts = append(*parts, p.mcids[pg][int(mcid)])
+				}
+			case obj_named("OBJR"): // annotations and XObjects, no text
+			default:
+				kid := element(v, pg)
+				e.Kids = append(e.Kids, kid)
+				*parts = append(*parts, kid.Text)
+			}
+		}
+	}
+	element = func(dict obj_dict, pg obj_int) StructElement {
+		var e StructElement
+		if s, ok := dict["S"].Type.(obj_named); ok {
+			e.Type = role(s)
+		}
+		var parts []string
+		kids(dict["K"], pg, &e, &parts)
+		var text []string
+		for _, s := range parts {
+			if s = strings.TrimSpace(s); s != "" {
+				text = append(text, s)
+			}
+		}
+		e.Text = strings.Join(text, " ")
+		if s, ok := p.resolve_text(dict["ActualText"]); ok {
+			e.Text = s
+		} else if s, ok := p.resolve_text(dict["Alt"]); ok && e.Text == "" {
+			e.Text = s
+		}
+		return e
+	}
+
+	var top StructElement
+	var parts []string
+	kids(root["K"], 0, &top, &parts)
+	return top.Kids
+}
+
+// Find returns the elements of type `t` under `e`, `e` included.
+func (e StructElement) Find(t string) []StructElement {
+	var result []StructElement
+	if e.Type == t {
+		result = append(result, e)
+	}
+	for _, k := range e.Kids {
+		result = append(result, k.Find(t)...)
+	}
+	return result
+}
+
+// Table returns the text of the cells(TH, TD) of a Table element, by row.
+func (e StructElement) Table() [][]string {
+	var rows [][]string
+	for _, k := range e.Kids {
+		switch k.Type {
+		case "TR":
+			var row []string
+			for _, cell := range k.Kids {
+				if cell.Type == "TH" || cell.Type == "TD" {
+					row = append(row, cell.Text)
+				}
+			}
+			rows = append(rows, row)
+		case "THead", "TBody", "TFoot":
+			rows = append(rows, k.Table()...)
+		}
+	}
+	return rows
+}
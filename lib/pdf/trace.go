@@ -0,0 +1,101 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Tracing the operators of the content streams shows why a text was split,
+// joined or dropped: each operator with its operands, the state after it and
+// the text it produced.
+
+// TraceEvent is an operator of a content stream after it was executed.
+type TraceEvent struct {
+	Page      int        `json:"page"`   // from 1
+	Stream    int        `json:"stream"` // the content stream or Form XObject
+	Op        int        `json:"op"`     // the number of the operator in the stream, from 0
+	Operator  string     `json:"operator"`
+	Operands  []string   `json:"operands"`
+	CTM       [6]float64 `json:"ctm"`
+	TM        [6]float64 `json:"tm"`
+	Font      string     `json:"font,omitempty"`
+	Size      float64    `json:"size"`
+	CharSpace float64    `json:"char_space"`
+	WordSpace float64    `json:"word_space"`
+	Scale     float64    `json:"scale"`
+	Leading   float64    `json:"leading"`
+	Rise      float64    `json:"rise"`
+	Text      []string   `json:"text,omitempty"` // one entry by obj_text, more than one when TJ split the text
+}
+
+type tracer struct {
+	emit   func(TraceEvent)
+	page   int
+	stream obj_int
+	op     int
+	start  int // where the operands of the next operator start in the objs
+}
+
+func (ctx *parse_ctx) trace_operator(operator string, operands []obj, produced []obj) {
+	e := TraceEvent{
+		Page:      ctx.trace.page,
+		Stream:    int(ctx.trace.stream),
+		Op:        ctx.trace.op,
+		Operator:  operator,
+		Operands:  make([]string, len(operands)),
+		CTM:       ctx.ctm,
+		TM:        ctx.text.tm,
+		Size:      ctx.text.size,
+		CharSpace: ctx.text.char_space,
+		WordSpace: ctx.text.word_space,
+		Scale:     ctx.text.scale,
+		Leading:   ctx.text.leading,
+		Rise:      ctx.text.rise,
+	}
+	ctx.trace.op++
+	for i := range operands {
+		e.Operands[i] = format_obj(operands[i], "", true)
+	}
+	if ctx.font != nil {
+		e.Font = string(ctx.font.base_font)
+	}
+	for _, o := range produced {
+		if t, ok := o.Type.(obj_text); ok {
+			e.Text = append(e.Text, t.text)
+		}
+	}
+	ctx.trace.emit(e)
+}
+
+// Trace parses again the content streams of the page `page`, from 1, or of all
+// the pages when it is 0, and calls `emit` for each operator.
+func (p pdf) Trace(page int, emit func(TraceEvent)) error {
+	pages := p.pages()
+	if page < 0 || page > len(pages) {
+		return errors.New(fmt.Sprintf("ERROR: page %d not found, the document has %d pages", page, len(pages)))
+	}
+	for i, pg := range pages {
+		if page != 0 && i+1 != page {
+			continue
+		}
+		for _, id := range p.page_contents(pg) {
+			ind, err := p.lookup(id)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			data, err := p.decode_stream(ind)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			ctx := new_parse_ctx(&p, pg.id, pg.resources)
+			ctx.trace = &tracer{emit: emit, page: i + 1, stream: id}
+			if _, err := parse(data, p.color_space, p.Resources, ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
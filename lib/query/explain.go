@@ -0,0 +1,69 @@
+package query
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Step is the state of RunQueryStep after an op, to follow the run of a query.
+type Step struct {
+	N         int        // how many ops ran, this one included
+	Pc        int        // the index of the op
+	Op        string     // the op in the words of Explain
+	DataIndex int        // after the op
+	Item      string     // the item at DataIndex
+	EOF       bool       // DataIndex is past the text, there is no Item
+	Rows      [][]string // printed by the op
+	Next      int        // the op after a jump that was taken, 0 otherwise
+}
+
+// op_string writes the op in words. The labels are named after their index,
+// a jump goes to the op after its label.
+func op_string(o op) string {
+	switch o := o.(type) {
+	case op_label:
+		return fmt.Sprintf("L%d:", int(o))
+	case op_print:
+		return fmt.Sprintf("print %d", int(o))
+	case op_printindex:
+		return fmt.Sprintf("print #%d", int(o))
+	case op_incdataindex:
+		return fmt.Sprintf("skip %d", int(o))
+	case op_setdataindex:
+		return fmt.Sprintf("seek #%d", int(o))
+	case op_setdataindex_fromstr:
+		return "seek after " + strconv.Quote(string(o))
+	case op_stop_atstr:
+		return "stop at " + strconv.Quote(string(o))
+	case op_stopatdataindex:
+		return fmt.Sprintf("stop at #%d", int(o))
+	case op_jump:
+		var cond string
+		switch c := o.Condition.(type) {
+		case op_condition_str:
+			cond = "item == " + strconv.Quote(string(c))
+		case op_condition_index:
+			cond = fmt.Sprintf("index == %d", int(c))
+		case op_condition_eof:
+			cond = "end of the text"
+		}
+		return fmt.Sprintf("jump L%d unless %s", int(o.Label), cond)
+	}
+	return fmt.Sprintf("%v", o)
+}
+
+// Explain writes the ops the query `txt` is compiled to, one by line with
+// its index and the part of the query it comes from.
+func Explain(out io.Writer, txt string) error {
+	ops, spans, err := ParseQuerySpans(txt)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for i, o := range ops {
+		fmt.Fprintf(w, "%4d\t%s\t%s\n", i, op_string(o), txt[spans[i].Start:spans[i].End])
+	}
+	return w.Flush()
+}
@@ -0,0 +1,13 @@
+//go:build go1.18
+// +build go1.18
+
+package query
+
+import "testing"
+
+func FuzzParseQuery(f *testing.F) {
+	for _, q := range []string{`#2`, `@"START"+1[3@"END"]`, `[1@#10]`, `$"END"`, `[2 3 @"A"] [1]`, `@"A`, `#`, `[1+2]`} {
+		f.Add(q)
+	}
+	f.Fuzz(check_parse)
+}
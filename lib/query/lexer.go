@@ -0,0 +1,97 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type token_kind int
+
+const (
+	tok_eof      token_kind = iota
+	tok_number              // 123
+	tok_string              // "text", the text is without the quotes
+	tok_hash                // #
+	tok_plus                // +
+	tok_at                  // @
+	tok_dollar              // $
+	tok_lbracket            // [
+	tok_rbracket            // ]
+	tok_lbrace              // {
+	tok_rbrace              // }
+	tok_pipe                // |
+)
+
+var token_names = map[token_kind]string{
+	tok_eof:      "the end of the query",
+	tok_number:   "a number",
+	tok_string:   "a \"text\"",
+	tok_hash:     "`#`",
+	tok_plus:     "`+`",
+	tok_at:       "`@`",
+	tok_dollar:   "`$`",
+	tok_lbracket: "`[`",
+	tok_rbracket: "`]`",
+	tok_lbrace:   "`{`",
+	tok_rbrace:   "`}`",
+	tok_pipe:     "`|`",
+}
+
+func (k token_kind) String() string {
+	return token_names[k]
+}
+
+type token struct {
+	kind token_kind
+	text string
+	Span
+}
+
+var punctuation = map[byte]token_kind{
+	'#': tok_hash,
+	'+': tok_plus,
+	'@': tok_at,
+	'$': tok_dollar,
+	'[': tok_lbracket,
+	']': tok_rbracket,
+	'{': tok_lbrace,
+	'}': tok_rbrace,
+	'|': tok_pipe,
+}
+
+// lex returns the tokens of the query, the last one is tok_eof. Spaces only
+// separate the tokens.
+func lex(str string) ([]token, error) {
+	var result []token
+	for i := 0; i < len(str); {
+		c := str[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(str) && str[i] >= '0' && str[i] <= '9' {
+				i++
+			}
+			result = append(result, token{tok_number, str[start:i], Span{start, i}})
+		case c == '"':
+			end := strings.IndexByte(str[i+1:], '"')
+			if end == -1 {
+				return result, &Error{Span{i, len(str)}, "could not find the `\"` at the end of the text"}
+			}
+			end += i + 1
+			result = append(result, token{tok_string, str[i+1 : end], Span{i, end + 1}})
+			i = end + 1
+		default:
+			kind, ok := punctuation[c]
+			if !ok {
+				r, size := utf8.DecodeRuneInString(str[i:])
+				return result, &Error{Span{i, i + size}, fmt.Sprintf("unexpected `%c`", r)}
+			}
+			result = append(result, token{kind, str[i : i+1], Span{i, i + 1}})
+			i++
+		}
+	}
+	return append(result, token{tok_eof, "", Span{len(str), len(str)}}), nil
+}
@@ -0,0 +1,311 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The grammar of the queries, in EBNF:
+//
+//	query  = { item } .
+//	item   = print | skip | seek | loop .
+//	print  = "#" number .                 print the item number as a row
+//	skip   = "+" number .                 move number items forward
+//	seek   = "@" ( text | "#" number ) .  move after the text or to the item number
+//	loop   = "[" number { item | number } "]" .
+//	number = digit { digit } .
+//	text   = `"` { any byte but `"` } `"` .
+//
+// Spaces separate the tokens. A number in a loop prints a row of that many
+// items, at least 1. The last item of a loop is a number, the loop then stops at the end of
+// the text, or a seek and the loop stops when the current item is its text or
+// index. `$` and `{` are reserved, RunQuery has nothing for them.
+
+// Node is an item of the AST of a query.
+type Node interface {
+	span() Span
+	String() string
+}
+
+func (s Span) span() Span {
+	return s
+}
+
+// Query is the AST of a query.
+type Query struct {
+	Items []Node
+}
+
+// Print is `#n`, it prints the item n as a row.
+type Print struct {
+	Span
+	Index int
+}
+
+// Skip is `+n`, it moves n items forward.
+type Skip struct {
+	Span
+	N int
+}
+
+// Seek is `@"text"` or `@#n`.
+type Seek struct {
+	Span
+	Text    string
+	Index   int
+	ByIndex bool
+}
+
+// Count is a number in a loop, it prints a row of N items.
+type Count struct {
+	Span
+	N int
+}
+
+// Loop is `[n ...]`, its body starts with the Count n.
+type Loop struct {
+	Span
+	Body []Node
+}
+
+func (q *Query) String() string {
+	return join(q.Items)
+}
+
+func (n Print) String() string {
+	return fmt.Sprintf("#%d", n.Index)
+}
+
+func (n Skip) String() string {
+	return fmt.Sprintf("+%d", n.N)
+}
+
+func (n Seek) String() string {
+	if n.ByIndex {
+		return fmt.Sprintf("@#%d", n.Index)
+	}
+	return `@"` + n.Text + `"`
+}
+
+func (n Count) String() string {
+	return strconv.Itoa(n.N)
+}
+
+func (n Loop) String() string {
+	return "[" + join(n.Body) + "]"
+}
+
+func join(nodes []Node) string {
+	items := make([]string, len(nodes))
+	for i, n := range nodes {
+		items[i] = n.String()
+	}
+	return strings.Join(items, " ")
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+// next returns the current token and moves to the next one, tok_eof is never
+// passed.
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tok_eof {
+		p.i++
+	}
+	return t
+}
+
+// Parse returns the AST of the query. The error is a *Error.
+func Parse(txt string) (*Query, error) {
+	tokens, err := lex(txt)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens}
+	q := &Query{}
+	for p.peek().kind != tok_eof {
+		n, err := p.item(false)
+		if err != nil {
+			return nil, err
+		}
+		q.Items = append(q.Items, n)
+	}
+	return q, nil
+}
+
+// item parses an item of the query, `in_loop` allows the numbers of the rows.
+func (p *parser) item(in_loop bool) (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tok_hash:
+		n, s, err := p.number(t)
+		return Print{Span{t.Start, s.End}, n}, err
+	case tok_plus:
+		n, s, err := p.number(t)
+		return Skip{Span{t.Start, s.End}, n}, err
+	case tok_at:
+		return p.seek(t)
+	case tok_lbracket:
+		return p.loop(t)
+	case tok_number:
+		if !in_loop {
+			return nil, &Error{t.Span, fmt.Sprintf("the number %s is only valid inside `[]`, #%s prints the item %s", t.text, t.text, t.text)}
+		}
+		n, err := to_int(t)
+		if err == nil && n == 0 {
+			return nil, &Error{t.Span, "a row of 0 items, the loop would never move"}
+		}
+		return Count{t.Span, n}, err
+	case tok_string:
+		return nil, &Error{t.Span, "a text is only valid after `@`"}
+	case tok_lbrace, tok_dollar:
+		return nil, &Error{t.Span, fmt.Sprintf("%s not implemented", t.kind)}
+	case tok_rbracket:
+		return nil, &Error{t.Span, "`]` without `[`"}
+	}
+	return nil, &Error{t.Span, fmt.Sprintf("unexpected %s", t.kind)}
+}
+
+func to_int(t token) (int, error) {
+	n, err := strconv.ParseUint(t.text, 10, 32)
+	if err != nil {
+		return 0, &Error{t.Span, fmt.Sprintf("the number %s is too big", t.text)}
+	}
+	return int(n), nil
+}
+
+// number parses the number after the token `after`.
+func (p *parser) number(after token) (int, Span, error) {
+	t := p.next()
+	if t.kind != tok_number {
+		return 0, t.Span, &Error{t.Span, fmt.Sprintf("expected a number after %s, found %s", after.kind, t.kind)}
+	}
+	n, err := to_int(t)
+	return n, t.Span, err
+}
+
+// seek parses the target of the `@` token `t`.
+func (p *parser) seek(t token) (Node, error) {
+	var seek Seek
+	target := p.next()
+	switch target.kind {
+	case tok_string:
+		seek.Text = target.text
+		seek.Span = Span{t.Start, target.End}
+	case tok_hash:
+		n, s, err := p.number(target)
+		if err != nil {
+			return nil, err
+		}
+		seek.Index, seek.ByIndex = n, true
+		seek.Span = Span{t.Start, s.End}
+	default:
+		return nil, &Error{target.Span, fmt.Sprintf("expected \"text\" or #index after %s, found %s", t.kind, target.kind)}
+	}
+	return seek, nil
+}
+
+// loop parses the loop after the `[` token `t`.
+func (p *parser) loop(t token) (Node, error) {
+	n, s, err := p.number(t)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, &Error{s, "a row of 0 items, the loop would never move"}
+	}
+	loop := Loop{Body: []Node{Count{s, n}}}
+	for {
+		switch p.peek().kind {
+		case tok_eof:
+			return nil, &Error{t.Span, "`[` without `]`"}
+		case tok_rbracket:
+			end := p.next()
+			loop.Span = Span{t.Start, end.End}
+			if last := loop.Body[len(loop.Body)-1]; !is_count(last) && !is_seek(last) {
+				return nil, &Error{Span{last.span().Start, end.End}, "the end of `[]` is the number of items of a row, or @\"text\" or @#index where the loop stops"}
+			}
+			return loop, nil
+		}
+		item, err := p.item(true)
+		if err != nil {
+			return nil, err
+		}
+		loop.Body = append(loop.Body, item)
+	}
+}
+
+func is_count(n Node) bool {
+	_, ok := n.(Count)
+	return ok
+}
+
+func is_seek(n Node) bool {
+	_, ok := n.(Seek)
+	return ok
+}
+
+type compiler struct {
+	ops   []op
+	spans []Span
+}
+
+func (c *compiler) emit(o op, s Span) {
+	c.ops = append_op(c.ops, o)
+	c.spans = append(c.spans, s)
+}
+
+// Compile returns the ops of the query for RunQuery and where each one comes
+// from in the query.
+func (q *Query) Compile() ([]op, []Span) {
+	var c compiler
+	c.items(q.Items)
+	return c.ops, c.spans
+}
+
+func (c *compiler) items(items []Node) {
+	for _, n := range items {
+		switch n := n.(type) {
+		case Print:
+			c.emit(op_printindex(n.Index), n.Span)
+		case Skip:
+			c.emit(op_incdataindex(n.N), n.Span)
+		case Count:
+			c.emit(op_print(n.N), n.Span)
+		case Seek:
+			if n.ByIndex {
+				c.emit(op_setdataindex(n.Index), n.Span)
+			} else {
+				c.emit(op_setdataindex_fromstr(n.Text), n.Span)
+			}
+		case Loop:
+			// the jump at the end goes back after the label while the
+			// condition is false, the seek at the end of the body is the
+			// condition.
+			label := op_label(len(c.ops))
+			c.emit(label, Span{n.Start, n.Start + 1})
+			body := n.Body
+			jump := op_jump{Label: label, Condition: op_condition_eof(true)}
+			end := Span{n.End - 1, n.End}
+			if seek, ok := body[len(body)-1].(Seek); ok {
+				body = body[:len(body)-1]
+				if seek.ByIndex {
+					jump.Condition = op_condition_index(seek.Index)
+				} else {
+					jump.Condition = op_condition_str(seek.Text)
+				}
+				end = Span{seek.Start, n.End}
+			}
+			c.items(body)
+			c.emit(jump, end)
+		}
+	}
+}
@@ -1,11 +1,10 @@
 package query
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 )
 
 type op interface{}
@@ -53,94 +52,21 @@ func append_str_d(str [][]string, other_strs []string) [][]string {
 	return str
 }
 
-func append_str(str, other_strs []string) []string {
-	l := len(str)
-	n := l + len(other_strs)
-	if n >= cap(str) {
-		newstr := make([]string, (n+1)*2)
-		copy(newstr, str)
-		str = newstr
-	}
-	str = str[0:n]
-	copy(str[l:], other_strs)
-	return str
+// Span is where a token, an op or an error is in the query, the bytes from
+// Start to End.
+type Span struct {
+	Start int
+	End   int
 }
 
-func get_tokens(str string) ([]string, error) {
-	var result []string
-	var i int
-	for ; i < len(str); i++ {
-		switch str[i] {
-		case '#':
-			var index int
-			for j := range str[i+1:] {
-				if str[i+j+1] >= '0' && str[i+j+1] <= '9' {
-					index++
-				}
-			}
-			if index == 0 {
-				return result, errors.New(fmt.Sprintf("ERROR:%d no string index passed for %s\n", i, string(str[i])))
-			}
-			result = append_str(result, []string{str[i : i+1], str[i+1 : i+index+1]})
-			i += index + 1
-		case '"':
-			index := strings.IndexByte(str[i+1:], '"')
-			if index == -1 {
-				return result, errors.New(fmt.Sprintf("ERROR:%d could not find the END STRING token %s\n", i, string(str[i])))
-			}
-			result = append_str(result, []string{str[i : i+1], str[i+1 : i+index+1], str[i+index+1 : i+index+2]})
-			i += index + 1
-		case ' ', '\t', '\n', '\r':
-		case '[':
-			result = append_str(result, []string{str[i : i+1]})
-		case ']':
-			result = append_str(result, []string{str[i : i+1]})
-		case '@':
-			result = append_str(result, []string{str[i : i+1]})
-		case '$':
-			result = append_str(result, []string{str[i : i+1]})
-		case '{':
-			result = append_str(result, []string{str[i : i+1]})
-		case '}':
-			result = append_str(result, []string{str[i : i+1]})
-		case '|':
-			result = append_str(result, []string{str[i : i+1]})
-		case ',':
-		case '-':
-		case '+':
-			var num int
-			result = append_str(result, []string{str[i : i+1]})
-			i++
-			for j := range str[i:] {
-				if str[i+j] < '0' || str[i+j] > '9' {
-					break
-				}
-				num++
-			}
-			if num > 0 {
-				result = append_str(result, []string{str[i : i+num]})
-				i += num - 1
-				continue
-			}
-			return result, errors.New(fmt.Sprintf("ERROR:%d failed parse token `%s`\n", i, string(str[i])))
-		default:
-			var num int
-			for j := range str[i:] {
-				if str[i+j] < '0' || str[i+j] > '9' {
-					break
-				}
-				num++
-			}
-			if num > 0 {
-				result = append_str(result, []string{str[i : i+num]})
-				i += num - 1
-				continue
-			}
-			return result, errors.New(fmt.Sprintf("ERROR:%d failed parse token `%s`\n", i, string(str[i])))
-		}
-	}
+// Error is a query that could not be parsed, with where the problem is.
+type Error struct {
+	Span
+	Msg string
+}
 
-	return result, nil
+func (e *Error) Error() string {
+	return fmt.Sprintf("ERROR:%d %s", e.Start, e.Msg)
 }
 
 func pop(slice []string) ([]string, string) {
@@ -153,13 +79,49 @@ func pop(slice []string) ([]string, string) {
 	return slice, el
 }
 
+// OpsPerItem bounds the ops a query runs to OpsPerItem for each item of the
+// text, a query that needs more is in a loop that never ends.
+var OpsPerItem = 1000
+
+// how many ops run between the checks of the context
+const ctx_check = 1024
+
 func RunQuery(ops []op, data []string) ([][]string, error) {
+	return run_query(context.Background(), ops, data, nil)
+}
+
+// RunQueryContext is RunQuery stopping with the error of `ctx` when it is done.
+func RunQueryContext(ctx context.Context, ops []op, data []string) ([][]string, error) {
+	return run_query(ctx, ops, data, nil)
+}
+
+// RunQueryStep is RunQueryContext calling `step` after each op, when not nil.
+func RunQueryStep(ctx context.Context, ops []op, data []string, step func(Step)) ([][]string, error) {
+	return run_query(ctx, ops, data, step)
+}
+
+func run_query(ctx context.Context, ops []op, data []string, step func(Step)) ([][]string, error) {
 	var iq int
 	var data_index int
 	var result [][]string
-	for iq < len(ops) {
+	// where each loop started its last run, by its label
+	loop_start := map[int]int{}
+	budget := OpsPerItem * (len(data) + 1)
+	for n := 1; iq < len(ops); n++ {
+		if n > budget {
+			return result, errors.New(fmt.Sprintf("ERROR: the query ran %d ops on %d items without ending, the loop of op %d never ends", budget, len(data), iq))
+		}
+		if n%ctx_check == 1 {
+			select {
+			case <-ctx.Done():
+				return result, ctx.Err()
+			default:
+			}
+		}
+		pc, rows := iq, len(result)
 		switch op := ops[iq].(type) {
 		case op_label:
+			loop_start[iq] = data_index
 		case op_print:
 			var line []string
 			for i := op; i > 0 && data_index < len(data); i-- {
@@ -168,11 +130,21 @@ func RunQuery(ops []op, data []string) ([][]string, error) {
 			}
 			result = append_str_d(result, line)
 		case op_printindex:
+			if int(op) >= len(data) {
+				return result, errors.New(fmt.Sprintf("ERROR: #%d is past the last item, the text has %d items", int(op), len(data)))
+			}
 			result = append_str_d(result, []string{data[op]})
 		case op_setdataindex:
+			if int(op) > len(data) {
+				return result, errors.New(fmt.Sprintf("ERROR: @#%d is past the end, the text has %d items", int(op), len(data)))
+			}
 			data_index = int(op)
 		case op_incdataindex:
-			data_index++
+			// NOTE(elias): skipping past the end stops at the end, where the loops end.
+			data_index += int(op)
+			if data_index > len(data) {
+				data_index = len(data)
+			}
 		case op_setdataindex_fromstr:
 			found := false
 			var _index int
@@ -206,155 +178,47 @@ func RunQuery(ops []op, data []string) ([][]string, error) {
 			default:
 				return result, errors.New(fmt.Sprintf("Error: invalid jump condition: %v\n", op.Condition))
 			}
+			if iq != pc {
+				// NOTE(elias): a run of the loop that doesn't move the index runs the
+				// same way again, the loop never ends.
+				if loop_start[iq] == data_index {
+					return result, errors.New(fmt.Sprintf("ERROR: the loop of op %d never ends, it stays at the item %d", iq, data_index))
+				}
+				loop_start[iq] = data_index
+			}
 		default:
 			log.Println("Not implemented!")
 			return result, errors.New("Not implemented!")
 		}
+		if step != nil {
+			s := Step{N: n, Pc: pc, Op: op_string(ops[pc]), DataIndex: data_index, Rows: result[rows:]}
+			if data_index >= 0 && data_index < len(data) {
+				s.Item = data[data_index]
+			} else {
+				s.EOF = true
+			}
+			if _, ok := ops[pc].(op_jump); ok && iq != pc {
+				s.Next = iq + 1
+			}
+			step(s)
+		}
 		iq++
 	}
 	return result, nil
 }
 
 func ParseQuery(txt string) ([]op, error) {
-	var exec []op
-	tokens, err := get_tokens(txt)
+	exec, _, err := ParseQuerySpans(txt)
+	return exec, err
+}
+
+// ParseQuerySpans is ParseQuery with where each op comes from in the query.
+// The error is a *Error.
+func ParseQuerySpans(txt string) ([]op, []Span, error) {
+	q, err := Parse(txt)
 	if err != nil {
-		return exec, errors.New("Failed to parse the query.")
-	}
-	var i int
-	var cond_stack []string
-	for i < len(tokens) {
-		switch tokens[i] {
-		case "#":
-			i++
-			s_val := tokens[i]
-			_index, err := strconv.ParseUint(s_val, 10, 32)
-			index := int(_index)
-			if err != nil {
-				return exec, errors.New(fmt.Sprintf("Failed to parse index: %s\n", err))
-			}
-			exec = append_op(exec, op_printindex(index))
-			i++
-		case "+":
-			i++
-			s_val := tokens[i]
-			_index, err := strconv.ParseUint(s_val, 10, 32)
-			index := int(_index)
-			if err != nil {
-				return exec, errors.New(fmt.Sprintf("Failed to parse index: %s\n", err))
-			}
-			exec = append_op(exec, op_incdataindex(index))
-			i++
-		case "\"":
-			i++
-			cond_stack = append(cond_stack, tokens[i])
-			i += 2
-		case "@":
-			i++
-			if tokens[i] == "\"" {
-				i++
-				exec = append(exec, op_setdataindex_fromstr(tokens[i]))
-				i += 2
-			} else if tokens[i] == "#" {
-				i++
-				s_val := tokens[i]
-				_index, err := strconv.ParseUint(s_val, 10, 32)
-				index := int(_index)
-				if err != nil {
-					return exec, errors.New(fmt.Sprintf("Failed to parse index: %s\n", err))
-				}
-				exec = append_op(exec, op_setdataindex(index))
-				i++
-			}
-		case "$":
-			i++
-			if tokens[i] == "\"" {
-				i++
-				exec = append(exec, op_stop_atstr(tokens[i]))
-				i += 2
-			} else if tokens[i] == "#" {
-				i++
-				s_val := tokens[i]
-				_index, err := strconv.ParseUint(s_val, 10, 32)
-				index := int(_index)
-				if err != nil {
-					return exec, errors.New(fmt.Sprintf("Failed to parse index: %s\n", err))
-				}
-				exec = append(exec, op_stopatdataindex(index))
-				i++
-			}
-		case "{":
-			log.Printf("%s not implemented!", tokens[i])
-			return exec, errors.New(fmt.Sprintf("%s not implemented!\n", tokens[i]))
-		case "[":
-			exec = append_op(exec, op_label(len(exec)))
-			i++
-			s_val := tokens[i]
-			_count, err := strconv.ParseUint(s_val, 10, 32)
-			count := int(_count)
-			if err != nil {
-				return exec, errors.New(fmt.Sprintf("Expected number of elements to print in a line, got %s\n%\n", tokens[i], err))
-			}
-			exec = append_op(exec, op_print(count))
-			i++
-		case "]":
-			var l op_label
-			found_label := false
-			for i := len(exec) - 1; i >= 0; i-- {
-				_index, ok := exec[i].(op_label)
-				if ok {
-					found_label = true
-					l = _index
-				}
-			}
-			var jump op_jump
-			_, ok := exec[len(exec)-1].(op_print)
-			if ok && found_label {
-				jump = op_jump{Label: l}
-				jump.Condition = op_condition_eof(true)
-				exec = append_op(exec, jump)
-				i++
-				continue
-			}
-			if !ok && found_label {
-				_exec := exec[len(exec)-1]
-				exec = exec[:len(exec)-1]
-				jump = op_jump{Label: l}
-				switch val := _exec.(type) {
-				case op_setdataindex_fromstr:
-					jump.Condition = op_condition_str(val)
-				case op_setdataindex:
-					jump.Condition = op_condition_index(val)
-				default:
-					return exec, errors.New(fmt.Sprintf("Error: something wrong!!\n"))
-				}
-				exec = append_op(exec, jump)
-				i++
-			} else {
-				return exec, errors.New(fmt.Sprintf("Error: `]` jump something wrong!!\n"))
-			}
-		default:
-			s_val := tokens[i]
-			_num, err := strconv.ParseInt(s_val, 10, 32)
-			num := int(_num)
-			if err != nil {
-				return exec, errors.New(fmt.Sprintf("Failed to parse token, %s: %s", s_val, err))
-			}
-			found_label := false
-			for i := len(exec) - 1; i >= 0; i-- {
-				_, ok := exec[i].(op_label)
-				if ok {
-					found_label = true
-				}
-			}
-			if found_label {
-				exec = append_op(exec, op_print(num))
-				// exec[l].data = num
-			} else {
-				return exec, errors.New(fmt.Sprintf("Invalid token %s\n", s_val))
-			}
-			i++
-		}
+		return nil, nil, err
 	}
-	return exec, nil
+	exec, spans := q.Compile()
+	return exec, spans, nil
 }
@@ -1,7 +1,11 @@
 package query
 
 import (
+	"context"
 	"log"
+	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -10,27 +14,33 @@ func init() {
 }
 
 func TestTokens(t *testing.T) {
-	str := `[4 @"END"]`
-	tokens, err := get_tokens(str)
+	str := `[4 @"END"]#12+3`
+	tokens, err := lex(str)
 	if err != nil {
 		log.Println(err)
-		t.Fail()
+		t.FailNow()
 	}
-	if len(tokens) != 7 {
-		log.Printf("Length mismatch, expected %d, got %d\n", 9, len(tokens))
-		t.Fail()
+	expected := []token{
+		{tok_lbracket, "[", Span{0, 1}},
+		{tok_number, "4", Span{1, 2}},
+		{tok_at, "@", Span{3, 4}},
+		{tok_string, "END", Span{4, 9}},
+		{tok_rbracket, "]", Span{9, 10}},
+		{tok_hash, "#", Span{10, 11}},
+		{tok_number, "12", Span{11, 13}},
+		{tok_plus, "+", Span{13, 14}},
+		{tok_number, "3", Span{14, 15}},
+		{tok_eof, "", Span{15, 15}},
 	}
-	if tokens[2] != "@" {
-		log.Printf("Expected `%s`, found `%s`\n", "@", tokens[2])
-		t.Fail()
+	if len(tokens) != len(expected) {
+		log.Printf("Length mismatch, expected %d, got %d\n", len(expected), len(tokens))
+		t.FailNow()
 	}
-	if tokens[0] != "[" {
-		log.Printf("Expected `%s`, found `%s`\n", "[", tokens[0])
-		t.Fail()
-	}
-	if tokens[4] != "END" {
-		log.Printf("Expected `%s`, found `%s`\n", "END", tokens[4])
-		t.Fail()
+	for i := range tokens {
+		if tokens[i] != expected[i] {
+			log.Printf("Expected `%v`, found `%v`\n", expected[i], tokens[i])
+			t.Fail()
+		}
 	}
 }
 
@@ -109,3 +119,256 @@ func TestEndIndex(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestIncrement(t *testing.T) {
+	txt := []string{"START", "skip 1", "skip 2", "a", "b", "c", "d"}
+	for str, expected := range map[string]string{
+		`@"START"+1[2]`: "skip 2 a|b c|d",
+		`@"START"+2[2]`: "a b|c d",
+		`@"START"+3[2]`: "b c|d",
+		`+3+3#0[1]`:     "START|d",
+		`+10[1]`:        "",
+	} {
+		query, err := ParseQuery(str)
+		if err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		result, err := RunQuery(query, txt)
+		if err != nil {
+			log.Printf("`%s`: %s\n", str, err)
+			t.Fail()
+			continue
+		}
+		rows := make([]string, len(result))
+		for i, r := range result {
+			rows[i] = strings.Join(r, " ")
+		}
+		if strings.Join(rows, "|") != expected {
+			log.Printf("`%s`: expected `%s`, found %q\n", str, expected, result)
+			t.Fail()
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for str, expected := range map[string]Span{
+		`@`:          {1, 1},
+		`[`:          {1, 1},
+		`]`:          {0, 1},
+		`+x`:         {1, 2},
+		`"abc`:       {0, 4},
+		`@"A"[1]+2]`: {9, 10},
+		`3`:          {0, 1},
+		`@"A"[1]${}`: {7, 8},
+		`[0]`:        {1, 2},
+		`[2 0@"A"]`:  {3, 4},
+		`$"END"`:     {0, 1},
+		`[1$#3]`:     {2, 3},
+		`[2@"END" {`: {9, 10},
+	} {
+		_, err := ParseQuery(str)
+		e, ok := err.(*Error)
+		if !ok {
+			log.Printf("`%s`: expected a *Error, found %v\n", str, err)
+			t.Fail()
+			continue
+		}
+		if e.Span != expected {
+			log.Printf("`%s`: expected the error at %v, found %v: %s\n", str, expected, e.Span, e)
+			t.Fail()
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	str := `@"START" +1 [3 @"END"]`
+	query, spans, err := ParseQuerySpans(str)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if len(spans) != len(query) {
+		log.Printf("expected a span by op, found %d spans for %d ops\n", len(spans), len(query))
+		t.FailNow()
+	}
+	expected := []string{`@"START"`, `+1`, `[`, `3`, `@"END"]`}
+	for i, s := range spans {
+		if i >= len(expected) || str[s.Start:s.End] != expected[i] {
+			log.Printf("op %d: found `%s`, expected %v\n", i, str[s.Start:s.End], expected)
+			t.Fail()
+		}
+	}
+}
+
+// check_parse checks what any query must satisfy: a *Error inside the query
+// when it is not valid, a span by op and the same ops from the query written
+// back from the AST otherwise.
+func check_parse(t *testing.T, str string) {
+	ops, spans, err := ParseQuerySpans(str)
+	if err != nil {
+		e, ok := err.(*Error)
+		if !ok || e.Start < 0 || e.Start > e.End || e.End > len(str) {
+			t.Fatalf("`%s`: invalid error %#v", str, err)
+		}
+		return
+	}
+	if len(spans) != len(ops) {
+		t.Fatalf("`%s`: %d spans for %d ops", str, len(spans), len(ops))
+	}
+	for _, s := range spans {
+		if s.Start < 0 || s.Start > s.End || s.End > len(str) {
+			t.Fatalf("`%s`: invalid span %v", str, s)
+		}
+	}
+	// the VM stops with an error on any program, it never panics or hangs
+	RunQuery(ops, []string{"A", "1", "23"})
+	q, _ := Parse(str)
+	again, err := ParseQuery(q.String())
+	if err != nil {
+		t.Fatalf("`%s`: `%s` is not valid: %s", str, q, err)
+	}
+	if !reflect.DeepEqual(ops, again) {
+		t.Fatalf("`%s`: `%s` has other ops, %v and %v", str, q, ops, again)
+	}
+}
+
+func TestRandomQueries(t *testing.T) {
+	pieces := []string{"@", "$", "#", "+", "[", "]", "{", "|", " ", "1", "23", `"A"`, `"`, "-", ",", "x", "é"}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		var b strings.Builder
+		for n := r.Intn(12); n > 0; n-- {
+			b.WriteString(pieces[r.Intn(len(pieces))])
+		}
+		check_parse(t, b.String())
+	}
+}
+
+func TestExplain(t *testing.T) {
+	var b strings.Builder
+	if err := Explain(&b, `@"START"+1[3@"END"]`); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	expected := `   0  seek after "START"            @"START"
+   1  skip 1                        +1
+   2  L2:                           [
+   3  print 3                       3
+   4  jump L2 unless item == "END"  @"END"]
+`
+	if b.String() != expected {
+		log.Printf("expected\n%s\nfound\n%s", expected, b.String())
+		t.Fail()
+	}
+}
+
+func TestSteps(t *testing.T) {
+	txt := []string{"START", "a", "b", "c", "d", "END", "e"}
+	query, err := ParseQuery(`@"START"[2@"END"]`)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	var steps []Step
+	result, err := RunQueryStep(context.Background(), query, txt, func(s Step) {
+		steps = append(steps, s)
+	})
+	if err != nil || len(result) != 2 {
+		log.Printf("unexpected result %v: %v\n", result, err)
+		t.FailNow()
+	}
+	// seek, label, print, jump back, print, jump out
+	if len(steps) != 6 {
+		log.Printf("expected 6 steps, found %v\n", steps)
+		t.FailNow()
+	}
+	if steps[3].Next != 2 || steps[3].Item != "c" || steps[5].Next != 0 || steps[5].Item != "END" {
+		log.Printf("unexpected jumps %v and %v\n", steps[3], steps[5])
+		t.Fail()
+	}
+	if len(steps[4].Rows) != 1 || steps[4].Rows[0][1] != "d" {
+		log.Printf("expected the row of c and d, found %v\n", steps[4].Rows)
+		t.Fail()
+	}
+}
+
+func TestBounds(t *testing.T) {
+	txt := []string{"a", "b", "c"}
+	for str, ok := range map[string]bool{
+		`#2`:      true,
+		`#3`:      false,
+		`#999`:    false,
+		`@#3[1]`:  true,
+		`@#4[1]`:  false,
+		`+100[1]`: true,
+	} {
+		query, err := ParseQuery(str)
+		if err != nil {
+			log.Println(err)
+			t.Fail()
+			continue
+		}
+		_, err = RunQuery(query, txt)
+		if (err == nil) != ok {
+			log.Printf("`%s`: unexpected error %v\n", str, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestLoopMoves(t *testing.T) {
+	txt := []string{"a", "b", "c", "END"}
+	for str, ok := range map[string]bool{
+		`[1]`:             true,
+		`[1@"END"]`:       true,
+		`[1 @#0 @"END"]`:  false, // back to the start at each run
+		`[1 @#3 @"END"]`:  true,
+		`[1 +0 @"END"]`:   true,
+		`[2 [1@#4] @#0]`:  false, // stays at the end of the text
+		`@#4[1]`:          true,
+		`[1 @"a" @"END"]`: true,
+	} {
+		query, err := ParseQuery(str)
+		if err != nil {
+			log.Println(err)
+			t.Fail()
+			continue
+		}
+		_, err = RunQuery(query, txt)
+		if (err == nil) != ok || err != nil && !strings.Contains(err.Error(), "never ends") {
+			log.Printf("`%s`: unexpected error %v\n", str, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	defer func(n int) { OpsPerItem = n }(OpsPerItem)
+	OpsPerItem = 1
+	query, err := ParseQuery(`[1]`)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	_, err = RunQuery(query, []string{"a", "b", "c"})
+	if err == nil || !strings.Contains(err.Error(), "without ending") {
+		log.Printf("expected the query to be stopped, found %v\n", err)
+		t.Fail()
+	}
+}
+
+func TestContext(t *testing.T) {
+	query, err := ParseQuery(`[1]`)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = RunQueryContext(ctx, query, make([]string, 100))
+	if err != context.Canceled {
+		log.Printf("expected %v, found %v\n", context.Canceled, err)
+		t.Fail()
+	}
+}
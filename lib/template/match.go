@@ -0,0 +1,120 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Match are the rules that tell if a document is of the kind of statement of
+// a template. Each rule found in the document adds to the score of the
+// template, the anchors weight more as they are the most reliable.
+type Match struct {
+	Producer string    `json:"producer,omitempty"`  // part of the /Producer of the document info
+	Creator  string    `json:"creator,omitempty"`   // part of the /Creator
+	Anchors  []string  `json:"anchors,omitempty"`   // texts found in the document
+	PageSize []float64 `json:"page_size,omitempty"` // width and height of the first page, in points
+	Fonts    []string  `json:"fonts,omitempty"`     // part of the names of fonts used by the pages
+}
+
+// Document is what the rules are checked against.
+type Document struct {
+	Producer  string
+	Creator   string
+	Text      []string
+	PageSizes [][2]float64
+	Fonts     []string
+}
+
+const (
+	weight_anchor = 2
+	weight_other  = 1
+	// the smallest score of a template chosen by Select
+	min_confidence = 0.5
+	// page sizes are rounded differently by each producer
+	page_size_tolerance = 2
+)
+
+// Score is how much a document looks like the documents of a template.
+type Score struct {
+	Template   Template
+	Confidence float64 // from 0 to 1, the weight of the rules found over the weight of all the rules
+	Missing    []string
+}
+
+// score returns the confidence of `doc` being of the kind of `m`, and the
+// rules that were not found. Without rules it is 0.
+func (m Match) score(doc Document) (float64, []string) {
+	var total, found float64
+	var missing []string
+	check := func(ok bool, weight float64, rule string) {
+		total += weight
+		if ok {
+			found += weight
+		} else {
+			missing = append(missing, rule)
+		}
+	}
+	contains := func(list []string, s string) bool {
+		for _, e := range list {
+			if strings.Contains(e, s) {
+				return true
+			}
+		}
+		return false
+	}
+	if m.Producer != "" {
+		check(strings.Contains(doc.Producer, m.Producer), weight_other, "producer "+m.Producer)
+	}
+	if m.Creator != "" {
+		check(strings.Contains(doc.Creator, m.Creator), weight_other, "creator "+m.Creator)
+	}
+	for _, a := range m.Anchors {
+		check(contains(doc.Text, a), weight_anchor, fmt.Sprintf("anchor %q", a))
+	}
+	if len(m.PageSize) == 2 {
+		ok := false
+		if len(doc.PageSizes) > 0 {
+			w, h := doc.PageSizes[0][0], doc.PageSizes[0][1]
+			near := func(a, b float64) bool { return math.Abs(a-b) <= page_size_tolerance }
+			ok = (near(w, m.PageSize[0]) && near(h, m.PageSize[1])) || (near(w, m.PageSize[1]) && near(h, m.PageSize[0]))
+		}
+		check(ok, weight_other, fmt.Sprintf("page size %vx%v", m.PageSize[0], m.PageSize[1]))
+	}
+	for _, f := range m.Fonts {
+		check(contains(doc.Fonts, f), weight_other, "font "+f)
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return found / total, missing
+}
+
+// Scores returns the score of each template with match rules, the best first.
+func (c Config) Scores(doc Document) []Score {
+	var result []Score
+	for _, t := range c.Templates {
+		if t.Match == nil {
+			continue
+		}
+		confidence, missing := t.Match.score(doc)
+		result = append(result, Score{t, confidence, missing})
+	}
+	// the first of the file wins a tie
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Confidence > result[j].Confidence })
+	return result
+}
+
+// Select returns the template that best matches `doc`.
+func (c Config) Select(doc Document) (Score, error) {
+	scores := c.Scores(doc)
+	if len(scores) == 0 {
+		return Score{}, errors.New("ERROR: no template has match rules")
+	}
+	if scores[0].Confidence < min_confidence {
+		return scores[0], errors.New(fmt.Sprintf("ERROR: no template matches the document, the best is %s with a confidence of %.2f", scores[0].Template.Name, scores[0].Confidence))
+	}
+	return scores[0], nil
+}
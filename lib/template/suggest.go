@@ -0,0 +1,90 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Suggest returns a query that prints the rows like `row`, a row known to be
+// in `text`, from the text `start` until the text `end`. Without `start` the
+// rows start at the index of `row`, without `end` they go until the end. The
+// warnings tell when the rows will not be aligned.
+func Suggest(text []string, row []string, start, end string) (query string, warnings []string, err error) {
+	if len(row) == 0 {
+		return "", nil, errors.New("ERROR: the example row is empty")
+	}
+	for _, s := range []string{start, end} {
+		if strings.Contains(s, `"`) {
+			return "", nil, errors.New(fmt.Sprintf("ERROR: a query text can't have `\"`, found %s", s))
+		}
+	}
+	found := -1
+	for i := 0; i+len(row) <= len(text) && found == -1; i++ {
+		found = i
+		for j := range row {
+			if strings.TrimSpace(text[i+j]) != strings.TrimSpace(row[j]) {
+				found = -1
+				break
+			}
+		}
+	}
+	if found == -1 {
+		return "", nil, errors.New("ERROR: the example row was not found in the text, see the items of the row with `list`")
+	}
+
+	var q strings.Builder
+	if start == "" {
+		fmt.Fprintf(&q, "@#%d", found)
+	} else {
+		// the query starts after the first `start` of the text
+		s := index(text, start, 0)
+		if s == -1 || s >= found {
+			return "", nil, errors.New(fmt.Sprintf("ERROR: `%s` was not found before the example row", start))
+		}
+		fmt.Fprintf(&q, "@\"%s\"", start)
+		if found-s-1 > 0 {
+			fmt.Fprintf(&q, "+%d", found-s-1)
+		}
+		if found-s-1 >= len(row) {
+			warnings = append(warnings, fmt.Sprintf("the %d items between `%s` and the example row are skipped, use the first row as example to have them", found-s-1, start))
+		}
+	}
+	if end == "" {
+		fmt.Fprintf(&q, "[%d]", len(row))
+		if (len(text)-found)%len(row) != 0 {
+			warnings = append(warnings, fmt.Sprintf("the %d items after the example row are not rows of %d, the last row is partial", len(text)-found, len(row)))
+		}
+		return q.String(), warnings, nil
+	}
+	e := index(text, end, found+len(row))
+	if e == -1 {
+		return "", nil, errors.New(fmt.Sprintf("ERROR: `%s` was not found after the example row", end))
+	}
+	if (e-found)%len(row) != 0 {
+		warnings = append(warnings, fmt.Sprintf("`%s` is %d items after the example row, not at the end of a row of %d, the rows will go past it", end, e-found, len(row)))
+	}
+	fmt.Fprintf(&q, "[%d@\"%s\"]", len(row), end)
+	return q.String(), warnings, nil
+}
+
+// index returns the first index of `s` in `text` from `from`, or -1.
+func index(text []string, s string, from int) int {
+	for i := from; i < len(text); i++ {
+		if text[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add adds `t` to the templates, replacing the one with the same name.
+func (c *Config) Add(t Template) {
+	for i := range c.Templates {
+		if c.Templates[i].Name == t.Name {
+			c.Templates[i] = t
+			return
+		}
+	}
+	c.Templates = append(c.Templates, t)
+}
@@ -0,0 +1,290 @@
+package template
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A template is a query for a kind of statement with how to write its rows,
+// kept in a JSON file so the queries of each bank are not copied around:
+//
+//	{"templates": [
+//	  {"name": "nubank", "query": "@\"START\"+1[3@\"END\"]", "format": "csv",
+//	   "columns": [{"name": "date", "type": "date", "layout": "02-01"},
+//	               {"name": "description"},
+//	               {"name": "amount", "type": "number"}],
+//	   "match": {"producer": "Nu Pagamentos", "anchors": ["TRANSAÇÕES"]}}
+//	]}
+
+// Column is a column of the rows of a query.
+type Column struct {
+	Name   string `json:"name"`
+	Type   string `json:"type,omitempty"`   // text(the default), int, number or date
+	Layout string `json:"layout,omitempty"` // of date, in the Go time layout like 02/01/2006, written as 2006-01-02
+}
+
+// Template is a named query.
+type Template struct {
+	Name    string   `json:"name"`
+	Query   string   `json:"query"`
+	Format  string   `json:"format,omitempty"` // tsv(the default), csv or json
+	Columns []Column `json:"columns,omitempty"`
+	Match   *Match   `json:"match,omitempty"` // to choose the template with -template auto
+}
+
+// Config is the content of a templates file.
+type Config struct {
+	Templates []Template `json:"templates"`
+}
+
+// DefaultPath is where the templates are when no file is given:
+// $PDF_TO_DATA_TEMPLATES or pdf_to_data/templates.json in the user config dir.
+func DefaultPath() string {
+	if path := os.Getenv("PDF_TO_DATA_TEMPLATES"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "templates.json"
+	}
+	return filepath.Join(dir, "pdf_to_data", "templates.json")
+}
+
+// Load reads the templates file at `path`.
+func Load(path string) (Config, error) {
+	var config Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, errors.New(fmt.Sprintf("ERROR: invalid templates file %s: %s", path, err))
+	}
+	for i, t := range config.Templates {
+		if err := t.check(); err != nil {
+			return config, errors.New(fmt.Sprintf("ERROR: %s: template %d: %s", path, i, err))
+		}
+	}
+	return config, nil
+}
+
+// Save writes the templates to `path`. The file is replaced only when it was
+// fully written.
+func (c Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (t Template) check() error {
+	if t.Name == "" {
+		return errors.New("missing name")
+	}
+	if t.Query == "" {
+		return errors.New(fmt.Sprintf("%s: missing query", t.Name))
+	}
+	switch t.Format {
+	case "", "tsv", "csv", "json":
+	default:
+		return errors.New(fmt.Sprintf("%s: unknown format %s", t.Name, t.Format))
+	}
+	if t.Match != nil && len(t.Match.PageSize) != 0 && len(t.Match.PageSize) != 2 {
+		return errors.New(fmt.Sprintf("%s: the page size is [width, height]", t.Name))
+	}
+	for _, c := range t.Columns {
+		switch c.Type {
+		case "", "text", "int", "number":
+		case "date":
+			if c.Layout == "" {
+				return errors.New(fmt.Sprintf("%s: column %s: a date needs a layout", t.Name, c.Name))
+			}
+		default:
+			return errors.New(fmt.Sprintf("%s: column %s: unknown type %s", t.Name, c.Name, c.Type))
+		}
+	}
+	return nil
+}
+
+// Find returns the template `name`.
+func (c Config) Find(name string) (Template, error) {
+	for _, t := range c.Templates {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	names := make([]string, len(c.Templates))
+	for i, t := range c.Templates {
+		names[i] = t.Name
+	}
+	return Template{}, errors.New(fmt.Sprintf("ERROR: template %s not found, the templates are: %s", name, strings.Join(names, ", ")))
+}
+
+// value converts the cell `s` of the column, nil for an empty cell.
+func (c Column) value(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	switch c.Type {
+	case "int":
+		return strconv.Atoi(strings.Replace(strings.Replace(s, ".", "", -1), ",", "", -1))
+	case "number":
+		return parse_number(s)
+	case "date":
+		t, err := time.Parse(c.Layout, s)
+		if err != nil {
+			return nil, err
+		}
+		if t.Year() == 0 {
+			// statements often have the year only in the header
+			return t.Format("01-02"), nil
+		}
+		return t.Format("2006-01-02"), nil
+	}
+	return s, nil
+}
+
+// parse_number reads amounts like `1.234,56`, `1,234.56`, `-75` or `R$ 10,00`:
+// the last `.` or `,` followed by 1 or 2 digits is the decimal separator.
+func parse_number(s string) (float64, error) {
+	var b strings.Builder
+	for _, r := range s {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	n := b.String()
+	if i := strings.LastIndexAny(n, ".,"); i != -1 && len(n)-i-1 <= 2 {
+		n = strings.NewReplacer(".", "", ",", "").Replace(n[:i]) + "." + n[i+1:]
+	} else {
+		n = strings.NewReplacer(".", "", ",", "").Replace(n)
+	}
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid number %s", s))
+	}
+	return v, nil
+}
+
+// Convert checks the cells of `rows` against the types of the columns. The
+// converted values are nil for the empty cells.
+func (t Template) Convert(rows [][]string) ([][]interface{}, error) {
+	result := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		result[i] = make([]interface{}, len(row))
+		for j, cell := range row {
+			if j >= len(t.Columns) {
+				result[i][j] = cell
+				continue
+			}
+			v, err := t.Columns[j].value(cell)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("ERROR: row %d, column %s: %s", i, t.Columns[j].Name, err))
+			}
+			result[i][j] = v
+		}
+	}
+	return result, nil
+}
+
+// Write writes the rows of the query of the template to `out` in its format.
+func (t Template) Write(out io.Writer, rows [][]string) error {
+	values, err := t.Convert(rows)
+	if err != nil {
+		return err
+	}
+	header := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		header[i] = c.Name
+	}
+	cell := func(v interface{}) string {
+		switch v := v.(type) {
+		case nil:
+			return ""
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return fmt.Sprint(v)
+	}
+	switch t.Format {
+	case "csv":
+		w := csv.NewWriter(out)
+		if len(header) > 0 {
+			w.Write(header)
+		}
+		for _, row := range values {
+			line := make([]string, len(row))
+			for i := range row {
+				line[i] = cell(row[i])
+			}
+			w.Write(line)
+		}
+		w.Flush()
+		return w.Error()
+	case "json":
+		// an object by row when the columns have names, an array otherwise
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		for _, row := range values {
+			var err error
+			if len(header) == 0 {
+				err = enc.Encode(row)
+			} else {
+				record := map[string]interface{}{}
+				for i, v := range row {
+					name := fmt.Sprintf("column_%d", i)
+					if i < len(header) {
+						name = header[i]
+					}
+					record[name] = v
+				}
+				err = enc.Encode(record)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, row := range values {
+		line := make([]string, len(row))
+		for i := range row {
+			line[i] = cell(row[i])
+		}
+		if _, err := fmt.Fprintln(out, strings.Join(line, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
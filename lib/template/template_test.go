@@ -0,0 +1,179 @@
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func init() {
+	log.SetFlags(log.Lshortfile)
+}
+
+func TestLoad(t *testing.T) {
+	config, err := Load("../../sample/templates.json")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	tmpl, err := config.Find("example")
+	if err != nil || tmpl.Query != `@"START"+1[3@"END"]` || len(tmpl.Columns) != 3 {
+		log.Printf("unexpected template %+v %v\n", tmpl, err)
+		t.Fail()
+	}
+	if _, err := config.Find("missing"); err == nil {
+		log.Printf("expected the template `missing` not to be found\n")
+		t.Fail()
+	}
+
+	dir, err := ioutil.TempDir("", "pdf_to_data")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, invalid := range []string{
+		`{"templates": [{"name": "a"}]}`,
+		`{"templates": [{"name": "a", "query": "#1", "format": "xml"}]}`,
+		`{"templates": [{"name": "a", "query": "#1", "columns": [{"name": "d", "type": "date"}]}]}`,
+		`{"templates": [`,
+	} {
+		path := filepath.Join(dir, "templates.json")
+		ioutil.WriteFile(path, []byte(invalid), 0644)
+		if _, err := Load(path); err == nil {
+			log.Printf("expected `%s` to be invalid\n", invalid)
+			t.Fail()
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tmpl := Template{Name: "t", Query: "#0", Columns: []Column{
+		{Name: "date", Type: "date", Layout: "02/01/2006"},
+		{Name: "description"},
+		{Name: "amount", Type: "number"},
+	}}
+	rows := [][]string{{"06/01/2021", "Some, Stuff", "R$ 1.234,50"}, {"07/01/2021", "Other", "-75"}}
+	for format, expected := range map[string]string{
+		"":     "2021-01-06\tSome, Stuff\t1234.5\n2021-01-07\tOther\t-75\n",
+		"csv":  "date,description,amount\n2021-01-06,\"Some, Stuff\",1234.5\n2021-01-07,Other,-75\n",
+		"json": `{"amount":1234.5,"date":"2021-01-06","description":"Some, Stuff"}` + "\n" + `{"amount":-75,"date":"2021-01-07","description":"Other"}` + "\n",
+	} {
+		tmpl.Format = format
+		var out bytes.Buffer
+		if err := tmpl.Write(&out, rows); err != nil || out.String() != expected {
+			log.Printf("format `%s`: expected\n%s\nfound\n%s\n%v\n", format, expected, out.String(), err)
+			t.Fail()
+		}
+	}
+	if err := tmpl.Write(&bytes.Buffer{}, [][]string{{"06/13/2021"}}); err == nil {
+		log.Printf("expected the date to be invalid\n")
+		t.Fail()
+	}
+	for s, expected := range map[string]float64{"1,234.56": 1234.56, "1.234": 1234, "10,5": 10.5, "-3": -3} {
+		if v, err := parse_number(s); err != nil || v != expected {
+			log.Printf("parse_number(%s): expected %v, found %v %v\n", s, expected, v, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	config := Config{Templates: []Template{
+		{Name: "none", Query: "#0"},
+		{Name: "nubank", Query: "#0", Match: &Match{Producer: "Nu", Anchors: []string{"TRANSAÇÕES", "Total"}, Fonts: []string{"Gotham"}}},
+		{Name: "itau", Query: "#0", Match: &Match{Anchors: []string{"Itaú"}, PageSize: []float64{612, 792}}},
+	}}
+	doc := Document{
+		Producer:  "Nu Pagamentos S.A.",
+		Text:      []string{"Fatura", "TRANSAÇÕES DE 01 A 30", "Total a pagar"},
+		PageSizes: [][2]float64{{595.28, 841.89}},
+		Fonts:     []string{"Gotham-Book"},
+	}
+	s, err := config.Select(doc)
+	if err != nil || s.Template.Name != "nubank" || s.Confidence != 1 {
+		log.Printf("expected nubank with confidence 1, found %s %v %v\n", s.Template.Name, s.Confidence, err)
+		t.Fail()
+	}
+	scores := config.Scores(doc)
+	if len(scores) != 2 || scores[1].Template.Name != "itau" || len(scores[1].Missing) != 2 {
+		log.Printf("unexpected scores %+v\n", scores)
+		t.Fail()
+	}
+
+	// the anchors weight more than the producer
+	doc.Producer = "Other"
+	doc.Fonts = nil
+	if s, err := config.Select(doc); err != nil || s.Template.Name != "nubank" || s.Confidence != 4.0/6 {
+		log.Printf("expected nubank with confidence %v, found %s %v %v\n", 4.0/6, s.Template.Name, s.Confidence, err)
+		t.Fail()
+	}
+	// a landscape page of the same size
+	doc = Document{Text: []string{"Banco Itaú"}, PageSizes: [][2]float64{{792, 612}}}
+	if s, err := config.Select(doc); err != nil || s.Template.Name != "itau" || s.Confidence != 1 {
+		log.Printf("expected itau, found %s %v %v\n", s.Template.Name, s.Confidence, err)
+		t.Fail()
+	}
+	if _, err := config.Select(Document{Text: []string{"nothing"}}); err == nil {
+		log.Printf("expected no template to match\n")
+		t.Fail()
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	text := []string{"Title", "START", "Date", "Description", "Amount", "06-1", "Some Stuff", "10", "03-2", "This happened", "32", "END", "100"}
+	for _, test := range []struct {
+		row        []string
+		start, end string
+		query      string
+		warnings   int
+	}{
+		{[]string{"06-1", "Some Stuff", "10"}, "START", "END", `@"START"+3[3@"END"]`, 1},
+		{[]string{"Date", "Description", "Amount"}, "START", "END", `@"START"[3@"END"]`, 0},
+		{[]string{"03-2", "This happened", "32"}, "", "END", `@#8[3@"END"]`, 0},
+		{[]string{"06-1", "Some Stuff", "10"}, "", "", `@#5[3]`, 1},
+		{[]string{"Some Stuff", "10"}, "START", "END", `@"START"+4[2@"END"]`, 2},
+	} {
+		q, warnings, err := Suggest(text, test.row, test.start, test.end)
+		if err != nil || q != test.query || len(warnings) != test.warnings {
+			log.Printf("%q: expected `%s` with %d warnings, found `%s` %q %v\n", test.row, test.query, test.warnings, q, warnings, err)
+			t.Fail()
+		}
+	}
+	for _, test := range []struct {
+		row        []string
+		start, end string
+	}{
+		{[]string{"06-1", "Other"}, "", ""},
+		{[]string{"06-1"}, "END", ""},
+		{[]string{"06-1"}, "", "Title"},
+		{[]string{"06-1"}, `"START"`, ""},
+	} {
+		if _, _, err := Suggest(text, test.row, test.start, test.end); err == nil {
+			log.Printf("%q %s %s: expected an error\n", test.row, test.start, test.end)
+			t.Fail()
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "pdf_to_data")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config", "templates.json")
+	var config Config
+	config.Add(Template{Name: "a", Query: "#1"})
+	config.Add(Template{Name: "b", Query: "#2"})
+	config.Add(Template{Name: "a", Query: "#3"})
+	if err := config.Save(path); err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	loaded, err := Load(path)
+	if err != nil || len(loaded.Templates) != 2 || loaded.Templates[0].Query != "#3" {
+		log.Printf("unexpected templates %+v %v\n", loaded, err)
+		t.Fail()
+	}
+}